@@ -0,0 +1,278 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/arxanchain/safebox-sdk-go/api/internal/fingerprint"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// DefaultBatchConcurrency is the number of requests a batch keeps in flight
+// when BatchOptions.Concurrency is not set.
+const DefaultBatchConcurrency = 8
+
+// BatchOptions configures a batch operation.
+type BatchOptions struct {
+	// Concurrency bounds the number of requests in flight, it defaults to
+	// DefaultBatchConcurrency.
+	Concurrency int
+	// Progress, if not nil, is called after each item completes. Calls are
+	// serialized.
+	Progress func(BatchProgress)
+	// Checkpoint, if not nil, records the trusteed key pairs so that a
+	// batch run again after a crash skips them. It is only used by
+	// BatchTrusteeKeyPairs.
+	Checkpoint Checkpoint
+}
+
+// BatchProgress reports the progress of a batch operation.
+type BatchProgress struct {
+	// Total is the number of items of the batch.
+	Total int
+	// Completed is the number of items completed, successfully or not.
+	Completed int
+	// Failed is the number of items completed with an error.
+	Failed int
+	// UserDid is the DID of the item just completed, and Err its error.
+	UserDid string
+	Err     error
+}
+
+// TrusteeResult is the result of one item of BatchTrusteeKeyPairs.
+type TrusteeResult struct {
+	UserDid string
+	Reply   *safebox.SaveKeyPairReply
+	// Resumed reports that Reply was read from the checkpoint instead of
+	// being requested from the service.
+	Resumed bool
+	Err     error
+}
+
+// PublicKeyResult is the result of one item of BatchQueryPublicKeys.
+type PublicKeyResult struct {
+	UserDid string
+	Reply   *safebox.PublicKeyReply
+	Err     error
+}
+
+// BatchTrusteeKeyPairs trustees the key pairs of bodies, keeping at most
+// opts.Concurrency requests in flight. opts may be nil.
+//
+// The results are in the order of bodies, each carrying its own error. Each
+// request is sent with an idempotency key derived from its DID and public
+// key, so that a retried or resumed item gets the original reply back from
+// the service instead of an ErrUserExists error.
+//
+// The returned error is not nil if the batch stopped early, because ctx is
+// done or the checkpoint could not be written. The items that were not
+// attempted then carry that error.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) BatchTrusteeKeyPairs(ctx context.Context, header http.Header, bodies []*safebox.SaveKeyPairRequetBody, opts *BatchOptions) ([]TrusteeResult, error) {
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+	results := make([]TrusteeResult, len(bodies))
+	progress := newBatchProgress(len(bodies), opts.Progress)
+
+	ran, err := runBatch(ctx, OpTrusteeKeyPair, len(bodies), opts.Concurrency, func(ctx context.Context, i int) error {
+		body := bodies[i]
+		res := &results[i]
+		if body != nil {
+			res.UserDid = body.UserDid
+		}
+
+		if body != nil && opts.Checkpoint != nil {
+			if reply, ok := opts.Checkpoint.Load(body.UserDid); ok {
+				res.Reply, res.Resumed = reply, true
+				progress.done(res.UserDid, nil)
+				return nil
+			}
+		}
+
+		h := cloneHeader(header)
+		if body != nil {
+			SetIdempotencyKey(h, batchIdempotencyKey(body))
+		}
+		res.Reply, res.Err = s.TrusteeKeyPairWithContext(ctx, h, body)
+		progress.done(res.UserDid, res.Err)
+
+		if res.Err == nil && opts.Checkpoint != nil {
+			if err := opts.Checkpoint.Store(body.UserDid, res.Reply); err != nil {
+				return fmt.Errorf("write checkpoint: %v", err)
+			}
+		}
+		return nil
+	})
+	for i := range results {
+		if !ran[i] {
+			results[i].Err = err
+			if bodies[i] != nil {
+				results[i].UserDid = bodies[i].UserDid
+			}
+		}
+	}
+	return results, err
+}
+
+// BatchQueryPublicKeys queries the public keys of the key pairs of infos,
+// each with its DID and security code, keeping at most opts.Concurrency
+// requests in flight. opts may be nil.
+//
+// The results are in the order of infos, each carrying its own error. The
+// returned error is not nil if ctx is done before all the items were
+// attempted; these items then carry that error.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) BatchQueryPublicKeys(ctx context.Context, header http.Header, infos []*safebox.OperateKeyInfo, opts *BatchOptions) ([]PublicKeyResult, error) {
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+	results := make([]PublicKeyResult, len(infos))
+	progress := newBatchProgress(len(infos), opts.Progress)
+
+	ran, err := runBatch(ctx, OpQueryPublicKey, len(infos), opts.Concurrency, func(ctx context.Context, i int) error {
+		res := &results[i]
+		if infos[i] != nil {
+			res.UserDid = infos[i].UserDid
+		}
+		res.Reply, res.Err = s.QueryPublicKeyWithContext(ctx, header, infos[i])
+		progress.done(res.UserDid, res.Err)
+		return nil
+	})
+	for i := range results {
+		if !ran[i] {
+			results[i].Err = err
+			if infos[i] != nil {
+				results[i].UserDid = infos[i].UserDid
+			}
+		}
+	}
+	return results, err
+}
+
+// runBatch calls item for the indexes 0 to n-1, with at most concurrency
+// calls in flight. It stops starting calls once ctx is done or a call
+// returns an error, and returns that error along with which indexes were
+// run. A done ctx is reported as an ErrTransport *Error of operation op.
+func runBatch(ctx context.Context, op string, n, concurrency int, item func(ctx context.Context, i int) error) ([]bool, error) {
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	ran := make([]bool, n)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		stopErr  error
+		sem      = make(chan struct{}, concurrency)
+		stopping = make(chan struct{})
+	)
+	stop := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopErr == nil {
+			stopErr = err
+			close(stopping)
+		}
+	}
+
+loop:
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-stopping:
+			break loop
+		case <-ctx.Done():
+			stop(newError(op, ErrTransport, ctx.Err()))
+			break loop
+		}
+		// Both may be ready when sem is acquired
+		select {
+		case <-stopping:
+			<-sem
+			break loop
+		default:
+		}
+		if ctx.Err() != nil {
+			<-sem
+			stop(newError(op, ErrTransport, ctx.Err()))
+			break loop
+		}
+
+		ran[i] = true
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := item(ctx, i); err != nil {
+				stop(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return ran, stopErr
+}
+
+// batchProgress counts the completed items of a batch and reports them.
+type batchProgress struct {
+	mu       sync.Mutex
+	progress BatchProgress
+	report   func(BatchProgress)
+}
+
+func newBatchProgress(total int, report func(BatchProgress)) *batchProgress {
+	return &batchProgress{progress: BatchProgress{Total: total}, report: report}
+}
+
+func (p *batchProgress) done(userDid string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.Completed++
+	if err != nil {
+		p.progress.Failed++
+	}
+	p.progress.UserDid, p.progress.Err = userDid, err
+	if p.report != nil {
+		p.report(p.progress)
+	}
+}
+
+// batchIdempotencyKey returns the idempotency key of body in a batch, which
+// is the same every time the batch is run.
+func batchIdempotencyKey(body *safebox.SaveKeyPairRequetBody) string {
+	sum := sha256.Sum256([]byte("batch:" + fingerprint.Trustee(body)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// cloneHeader returns a copy of header, which may be nil.
+func cloneHeader(header http.Header) http.Header {
+	if header == nil {
+		return http.Header{}
+	}
+	return header.Clone()
+}
@@ -0,0 +1,212 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api_test
+
+import (
+	"context"
+	stderrors "errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"github.com/arxanchain/safebox-sdk-go/api/safeboxtest"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+func newBatchServer(t *testing.T) (*safeboxtest.Server, *api.SafeboxClient) {
+	srv := safeboxtest.NewServer()
+	client, err := srv.NewClient()
+	if err != nil {
+		srv.Close()
+		t.Fatalf("New safebox client fail: %v", err)
+	}
+	return srv, client
+}
+
+func batchBodies(dids ...string) []*safebox.SaveKeyPairRequetBody {
+	bodies := make([]*safebox.SaveKeyPairRequetBody, len(dids))
+	for i, d := range dids {
+		bodies[i] = &safebox.SaveKeyPairRequetBody{UserDid: d, PrivateKey: "private-" + d, PublicKey: "public-" + d}
+	}
+	return bodies
+}
+
+func TestBatchTrusteeKeyPairs(t *testing.T) {
+	srv, client := newBatchServer(t)
+	defer srv.Close()
+	srv.Seed(&safebox.SaveKeyPairRequetBody{UserDid: "did:3"}, "code-3")
+
+	// Count the requests in flight
+	var inFlight, maxInFlight int32
+	srv.AddHook(func(w http.ResponseWriter, r *http.Request) bool {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return false
+	})
+
+	bodies := batchBodies("did:1", "did:2", "did:3", "did:4", "did:5", "did:6")
+	var calls []api.BatchProgress
+	results, err := client.BatchTrusteeKeyPairs(context.Background(), http.Header{}, bodies, &api.BatchOptions{
+		Concurrency: 2,
+		Progress:    func(p api.BatchProgress) { calls = append(calls, p) },
+	})
+	if err != nil {
+		t.Fatalf("batch trustee error, %v", err)
+	}
+
+	for i, res := range results {
+		if res.UserDid != bodies[i].UserDid {
+			t.Fatalf("result %d should be for %s, got %s", i, bodies[i].UserDid, res.UserDid)
+		}
+		if i == 2 {
+			if !stderrors.Is(res.Err, api.ErrUserExists) {
+				t.Fatalf("result %d should fail with ErrUserExists, got %v", i, res.Err)
+			}
+			continue
+		}
+		if _, code, _ := srv.KeyPair(res.UserDid); res.Err != nil || res.Reply.Code != code {
+			t.Fatalf("unexpected result %d: %+v", i, res)
+		}
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > 2 {
+		t.Fatalf("at most 2 requests should be in flight, got %d", max)
+	}
+	if len(calls) != len(bodies) {
+		t.Fatalf("progress should be reported %d times, got %d", len(bodies), len(calls))
+	}
+	last := calls[len(calls)-1]
+	if last.Total != 6 || last.Completed != 6 || last.Failed != 1 {
+		t.Fatalf("unexpected final progress %+v", last)
+	}
+
+	// The idempotency keys of a batch are the same every time it is run
+	other, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("New safebox client fail: %v", err)
+	}
+	again, err := other.BatchTrusteeKeyPairs(context.Background(), http.Header{}, bodies[:1], nil)
+	if err != nil || again[0].Err != nil || again[0].Reply.Code != results[0].Reply.Code {
+		t.Fatalf("batch run again should get the original reply, got %+v", again[0])
+	}
+}
+
+func TestBatchTrusteeKeyPairsResume(t *testing.T) {
+	srv, client := newBatchServer(t)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "safebox")
+	if err != nil {
+		t.Fatalf("create temp dir error, %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint")
+	// A trusteed record, then one truncated by a crash
+	err = ioutil.WriteFile(path, []byte(`{"user_did":"did:1","code":"code-1"}`+"\n"+`{"user_did":"did:2","co`), 0600)
+	if err != nil {
+		t.Fatalf("write checkpoint error, %v", err)
+	}
+
+	checkpoint, err := api.OpenFileCheckpoint(path)
+	if err != nil {
+		t.Fatalf("open checkpoint error, %v", err)
+	}
+	results, err := client.BatchTrusteeKeyPairs(context.Background(), nil, batchBodies("did:1", "did:2", "did:3"), &api.BatchOptions{Checkpoint: checkpoint})
+	if err != nil {
+		t.Fatalf("batch trustee error, %v", err)
+	}
+	checkpoint.Close()
+
+	if !results[0].Resumed || results[0].Reply.Code != "code-1" {
+		t.Fatalf("first item should be resumed from the checkpoint: %+v", results[0])
+	}
+	if _, _, found := srv.KeyPair("did:1"); found {
+		t.Fatalf("resumed item should not be sent")
+	}
+	if results[1].Resumed || results[1].Err != nil || results[2].Err != nil {
+		t.Fatalf("other items should be trusteed: %+v", results)
+	}
+
+	checkpoint, err = api.OpenFileCheckpoint(path)
+	if err != nil {
+		t.Fatalf("reopen checkpoint error, %v", err)
+	}
+	defer checkpoint.Close()
+	if checkpoint.Len() != 3 {
+		t.Fatalf("checkpoint should hold 3 records, got %d", checkpoint.Len())
+	}
+	_, code, _ := srv.KeyPair("did:3")
+	if reply, ok := checkpoint.Load("did:3"); !ok || reply.Code != code {
+		t.Fatalf("checkpoint should hold did:3, got %+v", reply)
+	}
+}
+
+func TestBatchCanceled(t *testing.T) {
+	srv, client := newBatchServer(t)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := client.BatchTrusteeKeyPairs(ctx, http.Header{}, batchBodies("did:1", "did:2"), nil)
+	if !stderrors.Is(err, context.Canceled) {
+		t.Fatalf("canceled batch should fail with context.Canceled, got %v", err)
+	}
+	for _, res := range results {
+		if res.Err != err || res.UserDid == "" {
+			t.Fatalf("unattempted item should carry the batch error: %+v", res)
+		}
+	}
+}
+
+func TestBatchQueryPublicKeys(t *testing.T) {
+	srv, client := newBatchServer(t)
+	defer srv.Close()
+	for _, body := range batchBodies("did:1", "did:2", "did:3") {
+		srv.Seed(body, "code-"+body.UserDid)
+	}
+
+	infos := []*safebox.OperateKeyInfo{
+		{UserDid: "did:1", Code: "code-did:1"},
+		{UserDid: "did:2", Code: "wrong"},
+		{UserDid: "did:3", Code: "code-did:3"},
+		{UserDid: "did:4", Code: "code-did:4"},
+	}
+	results, err := client.BatchQueryPublicKeys(context.Background(), http.Header{}, infos, &api.BatchOptions{Concurrency: 3})
+	if err != nil {
+		t.Fatalf("batch query error, %v", err)
+	}
+	if results[0].Err != nil || results[0].Reply.PublicKey != "public-did:1" ||
+		results[2].Err != nil || results[2].Reply.PublicKey != "public-did:3" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	for _, i := range []int{1, 3} {
+		if !stderrors.Is(results[i].Err, api.ErrKeyNotFound) || results[i].UserDid != infos[i].UserDid {
+			t.Fatalf("item %d should fail with ErrKeyNotFound, got %+v", i, results[i])
+		}
+	}
+}
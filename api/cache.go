@@ -0,0 +1,253 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arxanchain/sdk-go-common/structs"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// DefaultPublicKeyCacheTTL is how long a public key is served from the
+// cache when PublicKeyCacheConfig.TTL is zero.
+const DefaultPublicKeyCacheTTL = 5 * time.Minute
+
+// PublicKeyCacheConfig configures the public key cache, see
+// WithPublicKeyCache.
+type PublicKeyCacheConfig struct {
+	// TTL is how long a public key is served from the cache. Zero means
+	// DefaultPublicKeyCacheTTL.
+	TTL time.Duration
+	// MaxEntries bounds the number of public keys cached, the least
+	// recently used being evicted first. Zero means 1024.
+	MaxEntries int
+}
+
+// WithPublicKeyCache makes QueryPublicKey serve public keys from an in
+// memory cache.
+//
+// Entries are keyed by DID, security code and API key, so that a cached
+// public key is only served to callers the service would have answered.
+// Concurrent misses for the same entry are merged into a single request.
+// The entries of a DID are dropped when the client trustees or deletes its
+// key pair or updates its security code, and can be dropped explicitly with
+// InvalidatePublicKey.
+func WithPublicKeyCache(cfg PublicKeyCacheConfig) ClientOption {
+	return func(s *SafeboxClient) {
+		s.publicKeys = newPublicKeyCache(cfg)
+	}
+}
+
+// InvalidatePublicKey drops the cached public keys of userDid. It does
+// nothing if the client has no public key cache.
+func (s *SafeboxClient) InvalidatePublicKey(userDid string) {
+	if s.publicKeys != nil {
+		s.publicKeys.invalidate(userDid)
+	}
+}
+
+// cacheKey identifies a cache entry. Security codes and API keys are only
+// kept hashed.
+type cacheKey struct {
+	userDid string
+	secret  [sha256.Size]byte
+}
+
+func newCacheKey(header http.Header, info *safebox.OperateKeyInfo) cacheKey {
+	h := sha256.New()
+	for _, field := range []string{header.Get(structs.APIKeyHeader), info.Code} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	k := cacheKey{userDid: info.UserDid}
+	h.Sum(k.secret[:0])
+	return k
+}
+
+type cacheEntry struct {
+	key       cacheKey
+	publicKey string
+	expires   time.Time
+}
+
+// flight is a public key request shared by concurrent misses.
+type flight struct {
+	done  chan struct{}
+	reply *safebox.PublicKeyReply
+	err   error
+}
+
+// publicKeyCache is a TTL and LRU bounded cache of public keys.
+type publicKeyCache struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[cacheKey]*list.Element
+	flights map[cacheKey]*flight
+	// gen is bumped by every invalidation, so that requests in flight
+	// across an invalidation do not fill the cache with stale keys.
+	gen uint64
+}
+
+func newPublicKeyCache(cfg PublicKeyCacheConfig) *publicKeyCache {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultPublicKeyCacheTTL
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 1024
+	}
+	return &publicKeyCache{
+		ttl:        cfg.TTL,
+		maxEntries: cfg.MaxEntries,
+		now:        time.Now,
+		lru:        list.New(),
+		entries:    make(map[cacheKey]*list.Element),
+		flights:    make(map[cacheKey]*flight),
+	}
+}
+
+// get returns the public key for key, calling fetch on a miss. Concurrent
+// misses share a single fetch.
+func (c *publicKeyCache) get(ctx context.Context, key cacheKey, fetch func(ctx context.Context) (*safebox.PublicKeyReply, error)) (*safebox.PublicKeyReply, error) {
+	for {
+		c.mu.Lock()
+		if el, ok := c.entries[key]; ok {
+			e := el.Value.(*cacheEntry)
+			if c.now().Before(e.expires) {
+				c.lru.MoveToFront(el)
+				c.mu.Unlock()
+				return &safebox.PublicKeyReply{PublicKey: e.publicKey}, nil
+			}
+			c.remove(el)
+		}
+
+		if f, ok := c.flights[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-f.done:
+			case <-ctx.Done():
+				return nil, newError(OpQueryPublicKey, ErrTransport, ctx.Err())
+			}
+			// The leader's context is not ours: try again if it was done
+			if f.err != nil && isContextError(f.err) && ctx.Err() == nil {
+				continue
+			}
+			return copyPublicKeyReply(f.reply), f.err
+		}
+
+		f := &flight{done: make(chan struct{})}
+		c.flights[key] = f
+		gen := c.gen
+		c.mu.Unlock()
+
+		c.lead(ctx, key, f, gen, fetch)
+		return copyPublicKeyReply(f.reply), f.err
+	}
+}
+
+// lead runs fetch for flight f, started at generation gen, and completes
+// f. The waiters of f are released even if fetch panics, with an error.
+func (c *publicKeyCache) lead(ctx context.Context, key cacheKey, f *flight, gen uint64, fetch func(ctx context.Context) (*safebox.PublicKeyReply, error)) {
+	completed := false
+	defer func() {
+		if !completed {
+			f.reply, f.err = nil, newError(OpQueryPublicKey, nil, fmt.Errorf("public key query panicked"))
+		}
+		c.mu.Lock()
+		if c.flights[key] == f {
+			delete(c.flights, key)
+		}
+		if f.err == nil && c.gen == gen {
+			c.add(key, f.reply.PublicKey)
+		}
+		c.mu.Unlock()
+		close(f.done)
+	}()
+
+	f.reply, f.err = fetch(ctx)
+	completed = true
+}
+
+// invalidate drops the entries of userDid.
+func (c *publicKeyCache) invalidate(userDid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for key, el := range c.entries {
+		if key.userDid == userDid {
+			c.remove(el)
+		}
+	}
+	// Later misses must not join requests sent before the invalidation
+	for key := range c.flights {
+		if key.userDid == userDid {
+			delete(c.flights, key)
+		}
+	}
+}
+
+// add stores publicKey for key, evicting the least recently used entry if
+// the cache is full. c.mu must be held.
+func (c *publicKeyCache) add(key cacheKey, publicKey string) {
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{
+		key:       key,
+		publicKey: publicKey,
+		expires:   c.now().Add(c.ttl),
+	})
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops el from the cache. c.mu must be held.
+func (c *publicKeyCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+// len returns the number of cached entries.
+func (c *publicKeyCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func copyPublicKeyReply(reply *safebox.PublicKeyReply) *safebox.PublicKeyReply {
+	if reply == nil {
+		return nil
+	}
+	copied := *reply
+	return &copied
+}
+
+func isContextError(err error) bool {
+	return stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,210 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	rtstructs "github.com/arxanchain/sdk-go-common/rest/structs"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestPublicKeyCacheHit(t *testing.T) {
+	initTestSafeboxClient(t, WithPublicKeyCache(PublicKeyCacheConfig{TTL: time.Minute}))
+	defer gock.Off()
+	now := time.Now()
+	safeboxClient.publicKeys.now = func() time.Time { return now }
+	for _, publicKey := range []string{"publickey1", "publickey2", "publickey3"} {
+		mockPayload(t, gock.New(safeboxURL).Get(publicURLPath), &safebox.PublicKeyReply{PublicKey: publicKey})
+	}
+
+	info := &safebox.OperateKeyInfo{UserDid: "did:1", Code: "code"}
+	for i := 0; i < 3; i++ {
+		reply, err := safeboxClient.QueryPublicKey(http.Header{}, info)
+		if err != nil {
+			t.Fatalf("query public key error, %v", err)
+		}
+		if reply.PublicKey != "publickey1" {
+			t.Fatalf("public key should be served from the cache, got %s", reply.PublicKey)
+		}
+	}
+
+	// Another security code is another entry
+	reply, err := safeboxClient.QueryPublicKey(http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:1", Code: "other"})
+	if err != nil {
+		t.Fatalf("query public key error, %v", err)
+	}
+	if reply.PublicKey != "publickey2" {
+		t.Fatalf("another security code should be queried, got %s", reply.PublicKey)
+	}
+
+	now = now.Add(time.Minute)
+	if reply, _ := safeboxClient.QueryPublicKey(http.Header{}, info); reply.PublicKey != "publickey3" {
+		t.Fatalf("expired public key should be queried again, got %s", reply.PublicKey)
+	}
+}
+
+func TestPublicKeyCacheEviction(t *testing.T) {
+	initTestSafeboxClient(t, WithPublicKeyCache(PublicKeyCacheConfig{TTL: time.Minute, MaxEntries: 2}))
+	defer gock.Off()
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath).Times(3), &safebox.PublicKeyReply{PublicKey: "publickey"})
+
+	for _, userDid := range []string{"did:1", "did:2", "did:1", "did:3", "did:1"} {
+		if _, err := safeboxClient.QueryPublicKey(http.Header{}, &safebox.OperateKeyInfo{UserDid: userDid}); err != nil {
+			t.Fatalf("query public key error, %v", err)
+		}
+	}
+	// did:2 is the least recently used when did:3 is added
+	if !gock.IsDone() || safeboxClient.publicKeys.len() != 2 {
+		t.Fatalf("expected 3 queries and 2 entries, got %d entries", safeboxClient.publicKeys.len())
+	}
+
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath).MatchParam("user_did", "did:2"), &safebox.PublicKeyReply{PublicKey: "publickey"})
+	if _, err := safeboxClient.QueryPublicKey(http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:2"}); err != nil {
+		t.Fatalf("query public key error, %v", err)
+	}
+	if !gock.IsDone() {
+		t.Fatalf("evicted entry should be queried again")
+	}
+}
+
+func TestPublicKeyCacheSingleflight(t *testing.T) {
+	initTestSafeboxClient(t, WithPublicKeyCache(PublicKeyCacheConfig{TTL: time.Minute}))
+	defer gock.Off()
+	// A single reply: a second query would fail
+	byPayload, err := json.Marshal(&safebox.PublicKeyReply{PublicKey: "publickey"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	gock.New(safeboxURL).
+		Get(publicURLPath).
+		Reply(http.StatusOK).
+		Delay(50 * time.Millisecond).
+		JSON(&rtstructs.Response{Payload: string(byPayload)})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply, err := safeboxClient.QueryPublicKeyWithContext(context.Background(), http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:1"})
+			if err != nil || reply.PublicKey != "publickey" {
+				t.Errorf("unexpected reply %v, %v", reply, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPublicKeyCacheInvalidatedByDelete(t *testing.T) {
+	initTestSafeboxClient(t, WithPublicKeyCache(PublicKeyCacheConfig{TTL: time.Minute}))
+	defer gock.Off()
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath).Times(2), &safebox.PublicKeyReply{PublicKey: "publickey"})
+	gock.New(safeboxURL).
+		Post(deleteURLPath).
+		Reply(http.StatusOK).
+		JSON(&rtstructs.Response{})
+
+	info := &safebox.OperateKeyInfo{UserDid: "did:1", Code: "code"}
+	if _, err := safeboxClient.QueryPublicKey(http.Header{}, info); err != nil {
+		t.Fatalf("query public key error, %v", err)
+	}
+	if err := safeboxClient.DeleteKeyPair(http.Header{}, info); err != nil {
+		t.Fatalf("delete key pair error, %v", err)
+	}
+	if safeboxClient.publicKeys.len() != 0 {
+		t.Fatalf("delete should drop the cached public key")
+	}
+	if _, err := safeboxClient.QueryPublicKey(http.Header{}, info); err != nil {
+		t.Fatalf("query public key error, %v", err)
+	}
+	if !gock.IsDone() {
+		t.Fatalf("expected 2 queries")
+	}
+}
+
+func TestPublicKeyCacheDefaultTTL(t *testing.T) {
+	c := newPublicKeyCache(PublicKeyCacheConfig{})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	var fetches int
+	fetch := func(ctx context.Context) (*safebox.PublicKeyReply, error) {
+		fetches++
+		return &safebox.PublicKeyReply{PublicKey: "publickey"}, nil
+	}
+	key := cacheKey{userDid: "did:1"}
+	for i := 0; i < 2; i++ {
+		if _, err := c.get(context.Background(), key, fetch); err != nil {
+			t.Fatalf("get error, %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("a zero TTL should cache for DefaultPublicKeyCacheTTL, got %d fetches", fetches)
+	}
+
+	now = now.Add(DefaultPublicKeyCacheTTL)
+	if _, err := c.get(context.Background(), key, fetch); err != nil || fetches != 2 {
+		t.Fatalf("expired public key should be fetched again, got %d fetches, %v", fetches, err)
+	}
+}
+
+func TestPublicKeyCacheFetchPanic(t *testing.T) {
+	c := newPublicKeyCache(PublicKeyCacheConfig{})
+	key := cacheKey{userDid: "did:1"}
+	started, release := make(chan struct{}), make(chan struct{})
+
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		c.get(context.Background(), key, func(ctx context.Context) (*safebox.PublicKeyReply, error) {
+			close(started)
+			<-release
+			panic("fetch")
+		})
+	}()
+	<-started
+
+	waited := make(chan error)
+	go func() {
+		_, err := c.get(context.Background(), key, func(ctx context.Context) (*safebox.PublicKeyReply, error) {
+			return nil, fmt.Errorf("waiter fetched")
+		})
+		waited <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if r := <-panicked; r != "fetch" {
+		t.Fatalf("the panic should reach the leader, got %v", r)
+	}
+	select {
+	case err := <-waited:
+		if err == nil {
+			t.Fatalf("waiter should fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("waiter should be released")
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// Checkpoint records the key pairs trusteed by BatchTrusteeKeyPairs, so that
+// an interrupted batch can be resumed. Implementations must be safe for
+// concurrent use.
+type Checkpoint interface {
+	// Load returns the reply recorded for userDid, if any.
+	Load(userDid string) (*safebox.SaveKeyPairReply, bool)
+	// Store records the reply of the key pair trusteed for userDid. It must
+	// not return before the record is durable.
+	Store(userDid string, reply *safebox.SaveKeyPairReply) error
+}
+
+// checkpointRecord is a line of a FileCheckpoint.
+type checkpointRecord struct {
+	UserDid string `json:"user_did"`
+	Code    string `json:"code"`
+}
+
+// FileCheckpoint is a Checkpoint appending its records to a file, one JSON
+// object per line.
+//
+// The file holds the security codes of the trusteed key pairs: it is
+// created readable by its owner only, and should be protected and removed
+// accordingly.
+type FileCheckpoint struct {
+	mu      sync.Mutex
+	f       *os.File
+	replies map[string]safebox.SaveKeyPairReply
+}
+
+var _ Checkpoint = (*FileCheckpoint)(nil)
+
+// OpenFileCheckpoint opens the checkpoint file at path, creating it if it
+// does not exist, and loads the records it holds. A truncated last record,
+// left by a crash while it was written, is ignored.
+func OpenFileCheckpoint(path string) (*FileCheckpoint, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &FileCheckpoint{f: f, replies: make(map[string]safebox.SaveKeyPairReply)}
+	var (
+		scanner = bufio.NewScanner(f)
+		line    int
+		badLine int
+		end     int64
+	)
+	for scanner.Scan() {
+		line++
+		if badLine != 0 {
+			f.Close()
+			return nil, fmt.Errorf("checkpoint %s: line %d is malformed", path, badLine)
+		}
+		var rec checkpointRecord
+		if err = json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.UserDid == "" {
+			badLine = line
+			continue
+		}
+		c.replies[rec.UserDid] = safebox.SaveKeyPairReply{Code: rec.Code}
+		end += int64(len(scanner.Bytes())) + 1
+	}
+	if err = scanner.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("checkpoint %s: %v", path, err)
+	}
+
+	// Drop the truncated record, if any, and append after the last one
+	info, err := f.Stat()
+	if err == nil {
+		if end > info.Size() {
+			// The last record is complete but its newline is missing
+			_, err = f.WriteAt([]byte{'\n'}, info.Size())
+		} else {
+			err = f.Truncate(end)
+		}
+	}
+	if err == nil {
+		_, err = f.Seek(end, 0)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Load implements Checkpoint.
+func (c *FileCheckpoint) Load(userDid string) (*safebox.SaveKeyPairReply, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reply, ok := c.replies[userDid]
+	if !ok {
+		return nil, false
+	}
+	return &reply, true
+}
+
+// Store implements Checkpoint. The record is synced to disk before Store
+// returns.
+func (c *FileCheckpoint) Store(userDid string, reply *safebox.SaveKeyPairReply) error {
+	b, err := json.Marshal(&checkpointRecord{UserDid: userDid, Code: reply.Code})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err = c.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err = c.f.Sync(); err != nil {
+		return err
+	}
+	c.replies[userDid] = *reply
+	return nil
+}
+
+// Len returns the number of key pairs recorded.
+func (c *FileCheckpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.replies)
+}
+
+// Close closes the checkpoint file.
+func (c *FileCheckpoint) Close() error {
+	return c.f.Close()
+}
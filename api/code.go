@@ -17,15 +17,10 @@ limitations under the License.
 package api
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
-	"reflect"
 
-	"github.com/arxanchain/sdk-go-common/errors"
-	"github.com/arxanchain/sdk-go-common/rest"
-	restapi "github.com/arxanchain/sdk-go-common/rest/api"
-	reststruct "github.com/arxanchain/sdk-go-common/rest/structs"
 	"github.com/arxanchain/sdk-go-common/structs/did"
 	"github.com/arxanchain/sdk-go-common/structs/safebox"
 )
@@ -34,69 +29,87 @@ import (
 //
 // API-Key must set to header.
 func (s *SafeboxClient) UpdateAssistCode(header http.Header, body *safebox.UpdateSecurityCodeRequestBody) error {
+	return s.UpdateAssistCodeWithContext(context.Background(), header, body)
+}
+
+// UpdateAssistCodeWithContext is like UpdateAssistCode but binds the request to ctx.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) UpdateAssistCodeWithContext(ctx context.Context, header http.Header, body *safebox.UpdateSecurityCodeRequestBody) error {
+	_, err := s.UpdateAssistCodeConfirmed(ctx, header, body)
+	return err
+}
+
+// UpdateAssistCodeConfirmed is like UpdateAssistCodeWithContext but also
+// returns the confirmation sent by the service.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) UpdateAssistCodeConfirmed(ctx context.Context, header http.Header, body *safebox.UpdateSecurityCodeRequestBody) (result *Confirmation, err error) {
 	if body == nil {
-		err := fmt.Errorf("request payload is null")
-		return err
+		err = newError(OpUpdateAssistCode, ErrInvalidRequest, fmt.Errorf("request payload is null"))
+		return
 	}
+	defer s.InvalidatePublicKey(body.UserDid)
 
 	// Build http request
-	r := s.c.NewRequest("POST", "/v1/code/update")
-	r.SetHeaders(header)
-	r.SetBody(body)
-
-	// Do http request
-	_, resp, err := restapi.RequireOK(s.c.DoRequest(r))
-	if err != nil {
-		return err
+	req := &request{
+		op:      OpUpdateAssistCode,
+		userDid: body.UserDid,
+		input:   body,
+		method:  "POST",
+		path:    "/v1/code/update",
+		body:    body,
 	}
-	defer resp.Body.Close()
 
-	// Parse http response
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("update code error")
+	// Do http request and parse http response
+	err = s.invoke(ctx, header, req, func(resp *http.Response) (interface{}, error) {
+		var decErr error
+		result, decErr = decodeConfirmation(OpUpdateAssistCode, resp)
+		return result, decErr
+	})
+	if err != nil {
+		result = nil
 	}
-
-	return nil
+	return
 }
 
 // RecoverAssistCode is used to recover assist code when user has forgot.
 //
 // API-Key must set to header.
 func (s *SafeboxClient) RecoverAssistCode(header http.Header, id did.Identifier) (result *safebox.CodeInfoReply, err error) {
+	return s.RecoverAssistCodeWithContext(context.Background(), header, id)
+}
+
+// RecoverAssistCodeWithContext is like RecoverAssistCode but binds the request to ctx.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) RecoverAssistCodeWithContext(ctx context.Context, header http.Header, id did.Identifier) (result *safebox.CodeInfoReply, err error) {
 	if id == "" {
-		err = fmt.Errorf("request information is empty")
+		err = newError(OpRecoverAssistCode, ErrInvalidRequest, fmt.Errorf("request information is empty"))
 		return
 	}
 
 	// Build http request
-	r := s.c.NewRequest("GET", "/v1/code")
-	r.SetHeaders(header)
-	r.SetParam("user_did", string(id))
-
-	// Do http request
-	_, resp, err := restapi.RequireOK(s.c.DoRequest(r))
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-
-	// Parse http response
-	var respBody reststruct.Response
-	if err = restapi.DecodeBody(resp, &respBody); err != nil {
-		return
+	req := &request{
+		op:      OpRecoverAssistCode,
+		userDid: string(id),
+		input:   id,
+		method:  "GET",
+		path:    "/v1/code",
+		params: map[string]string{
+			"user_did": string(id),
+		},
+		safe: true,
 	}
 
-	if respBody.ErrCode != errors.SuccCode {
-		err = rest.CodedError(respBody.ErrCode, respBody.ErrMessage)
-		return
-	}
-
-	payload, ok := respBody.Payload.(string)
-	if !ok {
-		err = fmt.Errorf("response payload type invalid: %v", reflect.TypeOf(respBody.Payload))
+	// Do http request and parse http response
+	var reply safebox.CodeInfoReply
+	err = s.invoke(ctx, header, req, func(resp *http.Response) (interface{}, error) {
+		return &reply, decodePayload(OpRecoverAssistCode, resp, &reply)
+	})
+	if err != nil {
 		return
 	}
-
-	err = json.Unmarshal([]byte(payload), &result)
+	result = &reply
 	return
 }
@@ -17,6 +17,7 @@ limitations under the License.
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -57,6 +58,81 @@ func TestUpdateAssistCodeSucc(t *testing.T) {
 	}
 }
 
+func TestUpdateAssistCodeConfirmation(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+
+	payload := &safebox.CodeInfoReply{
+		Code: "我爱你中国",
+	}
+	byPayload, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	respBody := &rtstructs.Response{
+		ErrCode: 0,
+		Payload: string(byPayload),
+	}
+	//mock http response
+	gock.New(safeboxURL).
+		Post(updateCodeURLPath).
+		Reply(http.StatusOK).
+		JSON(respBody)
+
+	header := http.Header{}
+	header.Set(structs.APIKeyHeader, apiKey)
+
+	req := &safebox.UpdateSecurityCodeRequestBody{
+		UserDid:      "did:anx:00001",
+		OriginalCode: "我是中国人",
+		NewCode:      "我爱你中国",
+	}
+
+	resp, err := safeboxClient.UpdateAssistCodeConfirmed(context.Background(), header, req)
+	if err != nil {
+		t.Fatalf("update code error, %v", err)
+	}
+	var confirmed safebox.CodeInfoReply
+	if err = resp.Decode(&confirmed); err != nil {
+		t.Fatalf("decode confirmation error, %v", err)
+	}
+	if confirmed.Code != "我爱你中国" {
+		t.Fatalf("update code confirmation error")
+	}
+}
+
+func TestUpdateAssistCodeErrCode(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+
+	respBody := &rtstructs.Response{
+		ErrCode:    errors.UserInfoNotExit,
+		ErrMessage: "user does not exist",
+	}
+	//mock http response
+	gock.New(safeboxURL).
+		Post(updateCodeURLPath).
+		Reply(http.StatusOK).
+		JSON(respBody)
+
+	header := http.Header{}
+	header.Set(structs.APIKeyHeader, apiKey)
+
+	req := &safebox.UpdateSecurityCodeRequestBody{
+		UserDid:      "did:anx:00001",
+		OriginalCode: "我是中国人",
+		NewCode:      "我爱你中国",
+	}
+
+	resp, err := safeboxClient.UpdateAssistCodeConfirmed(context.Background(), header, req)
+	if err == nil {
+		t.Fatalf("update code should fail on ErrCode")
+	}
+	if resp != nil {
+		t.Fatalf("update code response is error")
+	}
+}
+
 func TestUpdateAssistCodeFail(t *testing.T) {
 	initTestSafeboxClient(t)
 	defer gock.Off()
@@ -0,0 +1,98 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// contextHeader tags an outgoing request with the id of the context it was
+// issued with. restapi.Request has no way to carry a context, so the tag is
+// used by contextTransport to attach the context to the http request right
+// before it is sent. The header never leaves the process.
+const contextHeader = "X-Safebox-Sdk-Context"
+
+// contextTransport is a http.RoundTripper binding requests to the context
+// registered for them.
+type contextTransport struct {
+	base http.RoundTripper
+
+	mu   sync.Mutex
+	seq  uint64
+	ctxs map[string]context.Context
+}
+
+func newContextTransport(base http.RoundTripper) *contextTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &contextTransport{
+		base: base,
+		ctxs: make(map[string]context.Context),
+	}
+}
+
+// register stores ctx and returns the id to send in contextHeader.
+func (t *contextTransport) register(ctx context.Context) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	id := strconv.FormatUint(t.seq, 10)
+	t.ctxs[id] = ctx
+	return id
+}
+
+func (t *contextTransport) unregister(id string) {
+	t.mu.Lock()
+	delete(t.ctxs, id)
+	t.mu.Unlock()
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := req.Header.Get(contextHeader)
+	if id == "" {
+		return t.base.RoundTrip(req)
+	}
+
+	t.mu.Lock()
+	ctx, ok := t.ctxs[id]
+	t.mu.Unlock()
+	if !ok {
+		ctx = req.Context()
+	}
+
+	r := req.WithContext(ctx)
+	r.Header = req.Header.Clone()
+	r.Header.Del(contextHeader)
+	return t.base.RoundTrip(r)
+}
+
+// withContextClient returns a copy of client whose transport honours the
+// contexts registered on the returned contextTransport.
+func withContextClient(client *http.Client) (*http.Client, *contextTransport) {
+	var c http.Client
+	if client != nil {
+		c = *client
+	}
+	t := newContextTransport(c.Transport)
+	c.Transport = t
+	return &c, t
+}
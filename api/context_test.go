@@ -0,0 +1,124 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arxanchain/sdk-go-common/structs"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestQueryPrivateKeyWithContextDeadline(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+	// The reply is delayed until the request context is done
+	gock.New(safeboxURL).
+		Get(privateURLPath).
+		Reply(http.StatusOK).
+		Delay(10 * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	header := http.Header{}
+	header.Set(structs.APIKeyHeader, apiKey)
+	req := &safebox.OperateKeyInfo{
+		UserDid: "did:anx:00001",
+		Code:    "我是中国人",
+	}
+
+	start := time.Now()
+	resp, err := safeboxClient.QueryPrivateKeyWithContext(ctx, header, req)
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrTransport) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("query private response is error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("request was not aborted on deadline")
+	}
+}
+
+func TestDeleteKeyPairWithContextCanceled(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+	gock.New(safeboxURL).
+		Post(deleteURLPath).
+		Reply(http.StatusOK).
+		Delay(10 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	err := safeboxClient.DeleteKeyPairWithContext(ctx, http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:anx:00001"})
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, ErrTransport) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+}
+
+func TestRecoverAssistCodeWithContextDone(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+	gock.New(safeboxURL).
+		Get(recoverCodeURLPath).
+		Reply(http.StatusOK)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	resp, err := safeboxClient.RecoverAssistCodeWithContext(ctx, http.Header{}, "did:anx:00001")
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, ErrTransport) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("recover code response is error")
+	}
+	if !gock.IsPending() {
+		t.Fatalf("request should not be sent once the context is done")
+	}
+}
+
+func TestContextHeaderNotSent(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+	mockPayload(t, gock.New(safeboxURL).
+		Get(publicURLPath).
+		MatchHeader(structs.APIKeyHeader, apiKey).
+		AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+			return req.Header.Get(contextHeader) == "", nil
+		}), &safebox.PublicKeyReply{PublicKey: "publickey"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	header := http.Header{}
+	header.Set(structs.APIKeyHeader, apiKey)
+
+	resp, err := safeboxClient.QueryPublicKeyWithContext(ctx, header, &safebox.OperateKeyInfo{UserDid: "did:anx:00001"})
+	if err != nil {
+		t.Fatalf("get public error, context header leaked or api key missing, %v", err)
+	}
+	if resp.PublicKey != "publickey" {
+		t.Fatalf("get public return key error")
+	}
+}
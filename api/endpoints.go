@@ -0,0 +1,385 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of EndpointOptions.
+const (
+	DefaultMaxFailures         = 3
+	DefaultCoolDown            = 30 * time.Second
+	DefaultHealthCheckInterval = 10 * time.Second
+	DefaultHealthCheckTimeout  = 2 * time.Second
+)
+
+// EndpointOptions configures WithEndpoints. Zero fields take the default
+// values.
+type EndpointOptions struct {
+	// MaxFailures is the number of consecutive failures after which an
+	// endpoint is ejected, it defaults to DefaultMaxFailures.
+	MaxFailures int
+	// CoolDown is how long an ejected endpoint receives no request, it
+	// defaults to DefaultCoolDown. Once it has elapsed, a single failure
+	// ejects the endpoint again.
+	CoolDown time.Duration
+	// HealthCheckInterval is the period of the health checks, it defaults
+	// to DefaultHealthCheckInterval. A negative interval disables them.
+	HealthCheckInterval time.Duration
+	// HealthCheckPath is the path requested by the health checks, "/" by
+	// default. Any reply below 500 means the endpoint is healthy.
+	HealthCheckPath string
+	// HealthCheckTimeout bounds each health check, it defaults to
+	// DefaultHealthCheckTimeout.
+	HealthCheckTimeout time.Duration
+}
+
+// EndpointStatus is the state of an endpoint of WithEndpoints.
+type EndpointStatus struct {
+	Address string
+	// Healthy is the result of the last health check, true until the
+	// first one.
+	Healthy bool
+	// Failures is the number of consecutive failed requests.
+	Failures int
+	// EjectedUntil is the end of the cool-down of an ejected endpoint.
+	EjectedUntil time.Time
+}
+
+// WithEndpoints spreads the requests of the client over several safebox
+// gateways, e.g. in different regions. The address of the client config
+// defaults to the first endpoint.
+//
+// Endpoints are "host:port" addresses, using the scheme of the client
+// config, or URLs. Queries are balanced round-robin over the available
+// endpoints. Writes go to the first available endpoint, in the given
+// order, and fail over to the next one when the endpoint cannot be
+// reached; writes carrying an idempotency key, see SetIdempotencyKey, also
+// fail over when the endpoint fails to answer.
+//
+// Transport errors and 502, 503 and 504 replies count as failures. An
+// endpoint is ejected after opts.MaxFailures consecutive failures, for
+// opts.CoolDown, and skipped while its health checks fail. When no
+// endpoint is available, all of them are tried in order.
+//
+// The health checks run in the background until Close is called.
+func WithEndpoints(endpoints []string, opts *EndpointOptions) ClientOption {
+	return func(s *SafeboxClient) {
+		if opts == nil {
+			opts = &EndpointOptions{}
+		}
+		pool, err := newEndpointPool(endpoints, *opts)
+		if err != nil {
+			s.optionErr = err
+			return
+		}
+		if s.endpoints != nil {
+			s.endpoints.close()
+		}
+		s.endpoints = pool
+	}
+}
+
+// Endpoints returns the state of the endpoints set by WithEndpoints, nil
+// if there are none.
+func (s *SafeboxClient) Endpoints() []EndpointStatus {
+	if s.endpoints == nil {
+		return nil
+	}
+	return s.endpoints.status()
+}
+
+// Close stops the health checks started by WithEndpoints. The client must
+// not be used afterwards.
+func (s *SafeboxClient) Close() error {
+	if s.endpoints != nil {
+		s.endpoints.close()
+	}
+	return nil
+}
+
+// endpoint is an endpoint of an endpointPool.
+type endpoint struct {
+	address string
+	// scheme is empty if the address has none.
+	scheme string
+	host   string
+
+	// Guarded by endpointPool.mu
+	healthy      bool
+	failures     int
+	ejectedUntil time.Time
+}
+
+// endpointPool is a http.RoundTripper sending requests to the endpoints it
+// selects.
+type endpointPool struct {
+	base      http.RoundTripper
+	opts      EndpointOptions
+	endpoints []*endpoint
+	now       func() time.Time
+	// scheme is the scheme of the endpoints that have none.
+	scheme string
+
+	mu   sync.Mutex
+	next int
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+func newEndpointPool(addresses []string, opts EndpointOptions) (*endpointPool, error) {
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no endpoint")
+	}
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = DefaultMaxFailures
+	}
+	if opts.CoolDown <= 0 {
+		opts.CoolDown = DefaultCoolDown
+	}
+	if opts.HealthCheckInterval == 0 {
+		opts.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+	if opts.HealthCheckPath == "" {
+		opts.HealthCheckPath = "/"
+	}
+	if opts.HealthCheckTimeout <= 0 {
+		opts.HealthCheckTimeout = DefaultHealthCheckTimeout
+	}
+
+	p := &endpointPool{
+		base:   http.DefaultTransport,
+		opts:   opts,
+		now:    time.Now,
+		scheme: "http",
+		stop:   make(chan struct{}),
+	}
+	for _, address := range addresses {
+		ep := &endpoint{address: address, host: address, healthy: true}
+		if strings.Contains(address, "://") {
+			u, err := url.Parse(address)
+			if err != nil || u.Host == "" {
+				return nil, fmt.Errorf("invalid endpoint %q", address)
+			}
+			ep.scheme, ep.host = u.Scheme, u.Host
+		}
+		if ep.host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q", address)
+		}
+		p.endpoints = append(p.endpoints, ep)
+	}
+	return p, nil
+}
+
+// start sets the transport the pool sends requests with and the default
+// scheme of its endpoints, and starts the health checks.
+func (p *endpointPool) start(base http.RoundTripper, scheme string) {
+	if base != nil {
+		p.base = base
+	}
+	if scheme != "" {
+		p.scheme = scheme
+	}
+	if p.opts.HealthCheckInterval > 0 {
+		go p.healthChecks()
+	}
+}
+
+func (p *endpointPool) close() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+}
+
+// RoundTrip implements http.RoundTripper.
+func (p *endpointPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	getBody := req.GetBody
+	if req.Body != nil && req.Body != http.NoBody && getBody == nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		getBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(b)), nil
+		}
+	}
+
+	candidates := p.candidates(req.Method == http.MethodGet || req.Method == http.MethodHead)
+	for i, ep := range candidates {
+		r := req.Clone(req.Context())
+		r.Host = ""
+		r.URL.Host = ep.host
+		if ep.scheme != "" {
+			r.URL.Scheme = ep.scheme
+		}
+		if getBody != nil {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+
+		resp, err := p.base.RoundTrip(r)
+		failed := err != nil || isGatewayFailure(resp.StatusCode)
+		p.record(ep, failed)
+		if !failed || i == len(candidates)-1 || req.Context().Err() != nil || !canFailover(req, err) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+	// Not reached: there is at least one candidate
+	return nil, fmt.Errorf("no endpoint")
+}
+
+// candidates returns the endpoints to try, in order: the available ones,
+// rotated for reads, or all of them if none is available.
+func (p *endpointPool) candidates(read bool) []*endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	available := make([]*endpoint, 0, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		if ep.healthy && !now.Before(ep.ejectedUntil) {
+			available = append(available, ep)
+		}
+	}
+	if len(available) == 0 {
+		available = append(available, p.endpoints...)
+	}
+	if read {
+		start := p.next % len(available)
+		p.next++
+		available = append(available[start:], available[:start]...)
+	}
+	return available
+}
+
+// record counts a request to ep, ejecting it after too many consecutive
+// failures.
+func (p *endpointPool) record(ep *endpoint, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !failed {
+		ep.failures = 0
+		return
+	}
+	ep.failures++
+	if ep.failures >= p.opts.MaxFailures {
+		ep.ejectedUntil = p.now().Add(p.opts.CoolDown)
+	}
+}
+
+func (p *endpointPool) status() []EndpointStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := make([]EndpointStatus, len(p.endpoints))
+	for i, ep := range p.endpoints {
+		status[i] = EndpointStatus{
+			Address:      ep.address,
+			Healthy:      ep.healthy,
+			Failures:     ep.failures,
+			EjectedUntil: ep.ejectedUntil,
+		}
+	}
+	return status
+}
+
+// healthChecks checks the endpoints periodically until the pool is closed.
+func (p *endpointPool) healthChecks() {
+	ticker := time.NewTicker(p.opts.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		var wg sync.WaitGroup
+		for _, ep := range p.endpoints {
+			wg.Add(1)
+			go func(ep *endpoint) {
+				defer wg.Done()
+				healthy := p.check(ep)
+				p.mu.Lock()
+				ep.healthy = healthy
+				p.mu.Unlock()
+			}(ep)
+		}
+		wg.Wait()
+	}
+}
+
+// check requests the health check path of ep.
+func (p *endpointPool) check(ep *endpoint) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.HealthCheckTimeout)
+	defer cancel()
+	scheme := ep.scheme
+	if scheme == "" {
+		scheme = p.scheme
+	}
+	req, err := http.NewRequest(http.MethodGet, scheme+"://"+ep.host+p.opts.HealthCheckPath, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := p.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode < http.StatusInternalServerError
+}
+
+// isGatewayFailure reports whether status means the endpoint failed to
+// answer.
+func isGatewayFailure(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// canFailover reports whether a failed request may be sent to another
+// endpoint: queries and requests carrying an idempotency key always may,
+// other writes only if they could not reach the endpoint.
+func canFailover(req *http.Request, err error) bool {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead || req.Header.Get(IdempotencyKeyHeader) != "" {
+		return true
+	}
+	var opErr *net.OpError
+	return stderrors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,207 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	stderrors "errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/arxanchain/sdk-go-common/rest/api"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+const (
+	endpointA = "http://127.0.0.1:8015"
+	endpointB = "http://127.0.0.1:8016"
+)
+
+var (
+	publicKeyReply = &safebox.PublicKeyReply{PublicKey: "publickey"}
+	trusteeReply   = &safebox.SaveKeyPairReply{Code: "code"}
+)
+
+func trustee(client *SafeboxClient, header http.Header) error {
+	_, err := client.TrusteeKeyPairWithContext(context.Background(), header, &safebox.SaveKeyPairRequetBody{
+		UserDid:    "did:1",
+		PrivateKey: "privatekey",
+		PublicKey:  "publickey",
+	})
+	return err
+}
+
+func TestEndpointsBalanceReads(t *testing.T) {
+	defer gock.Off()
+	initTestSafeboxClient(t, WithEndpoints([]string{endpointA, endpointB}, &EndpointOptions{HealthCheckInterval: -1}))
+	defer safeboxClient.Close()
+	mockPayload(t, gock.New(endpointA).Get(publicURLPath).Times(5), publicKeyReply)
+	mockPayload(t, gock.New(endpointB).Get(publicURLPath).Times(5), publicKeyReply)
+	mockPayload(t, gock.New(endpointA).Post(trusteeURLPath).Times(3), trusteeReply)
+
+	for i := 0; i < 10; i++ {
+		if _, err := safeboxClient.QueryPublicKey(http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:1"}); err != nil {
+			t.Fatalf("query public key error, %v", err)
+		}
+	}
+	if len(gock.Pending()) != 1 {
+		t.Fatalf("reads should be balanced")
+	}
+
+	// Writes go to the first endpoint
+	for i := 0; i < 3; i++ {
+		if err := trustee(safeboxClient, http.Header{}); err != nil {
+			t.Fatalf("trustee key pair error, %v", err)
+		}
+	}
+	if !gock.IsDone() {
+		t.Fatalf("writes should go to the first endpoint")
+	}
+}
+
+func TestEndpointsEjection(t *testing.T) {
+	defer gock.Off()
+	initTestSafeboxClient(t, WithEndpoints([]string{endpointA, endpointB}, &EndpointOptions{
+		MaxFailures:         2,
+		CoolDown:            time.Minute,
+		HealthCheckInterval: -1,
+	}))
+	defer safeboxClient.Close()
+	now := time.Now()
+	safeboxClient.endpoints.now = func() time.Time { return now }
+	gock.New(endpointA).
+		Post(trusteeURLPath).
+		Persist().
+		ReplyError(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	b := mockPayload(t, gock.New(endpointB).Post(trusteeURLPath).Times(4), trusteeReply)
+
+	// Writes that cannot reach an endpoint fail over
+	for i := 0; i < 4; i++ {
+		if err := trustee(safeboxClient, http.Header{}); err != nil {
+			t.Fatalf("trustee key pair error, %v", err)
+		}
+	}
+	if !b.Mock.Done() {
+		t.Fatalf("writes should fail over")
+	}
+	status := safeboxClient.Endpoints()[0]
+	if status.Failures != 2 || !status.EjectedUntil.Equal(now.Add(time.Minute)) {
+		t.Fatalf("endpoint should be ejected after 2 failures, got %+v", status)
+	}
+
+	// Once the cool-down is over, a single failure ejects it again
+	now = now.Add(2 * time.Minute)
+	mockPayload(t, gock.New(endpointB).Post(trusteeURLPath), trusteeReply)
+	if err := trustee(safeboxClient, http.Header{}); err != nil {
+		t.Fatalf("trustee key pair error, %v", err)
+	}
+	status = safeboxClient.Endpoints()[0]
+	if status.Failures != 3 || !status.EjectedUntil.Equal(now.Add(time.Minute)) {
+		t.Fatalf("endpoint should be ejected again, got %+v", status)
+	}
+}
+
+func TestEndpointsWriteFailover(t *testing.T) {
+	defer gock.Off()
+	initTestSafeboxClient(t, WithEndpoints([]string{endpointA, endpointB}, &EndpointOptions{HealthCheckInterval: -1}))
+	defer safeboxClient.Close()
+	gock.New(endpointA).
+		Post(trusteeURLPath).
+		Times(2).
+		Reply(http.StatusServiceUnavailable)
+	b := mockPayload(t, gock.New(endpointB).Post(trusteeURLPath), trusteeReply)
+
+	// The write may have been applied: it is not sent again
+	if err := trustee(safeboxClient, http.Header{}); !stderrors.Is(err, ErrTransport) {
+		t.Fatalf("expected ErrTransport, got %v", err)
+	}
+	if b.Mock.Done() {
+		t.Fatalf("write without idempotency key should not fail over")
+	}
+
+	header := http.Header{}
+	SetIdempotencyKey(header, NewIdempotencyKey())
+	if err := trustee(safeboxClient, header); err != nil {
+		t.Fatalf("trustee key pair error, %v", err)
+	}
+	if !gock.IsDone() {
+		t.Fatalf("idempotent write should fail over")
+	}
+}
+
+func TestEndpointsHealthCheck(t *testing.T) {
+	defer gock.Off()
+	unhealthy := int32(1)
+	gock.New(endpointA).
+		Get("/health").
+		Persist().
+		AddMatcher(func(*http.Request, *gock.Request) (bool, error) {
+			return atomic.LoadInt32(&unhealthy) == 1, nil
+		}).
+		Reply(http.StatusInternalServerError)
+	gock.New(endpointA).
+		Get("/health").
+		Persist().
+		Reply(http.StatusNotFound)
+	gock.New(endpointB).
+		Get("/health").
+		Persist().
+		Reply(http.StatusOK)
+	a := mockPayload(t, gock.New(endpointA).Get(publicURLPath), publicKeyReply)
+	b := mockPayload(t, gock.New(endpointB).Get(publicURLPath).Times(4), publicKeyReply)
+
+	initTestSafeboxClient(t, WithEndpoints([]string{endpointA, endpointB}, &EndpointOptions{
+		HealthCheckInterval: 10 * time.Millisecond,
+		HealthCheckPath:     "/health",
+	}))
+	defer safeboxClient.Close()
+
+	waitHealthy := func(want bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for safeboxClient.Endpoints()[0].Healthy != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("endpoint health should become %v", want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitHealthy(false)
+	for i := 0; i < 4; i++ {
+		if _, err := safeboxClient.QueryPublicKey(http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:1"}); err != nil {
+			t.Fatalf("query public key error, %v", err)
+		}
+	}
+	if a.Mock.Done() || !b.Mock.Done() {
+		t.Fatalf("unhealthy endpoint should be skipped")
+	}
+
+	atomic.StoreInt32(&unhealthy, 0)
+	waitHealthy(true)
+}
+
+func TestEndpointsInvalid(t *testing.T) {
+	for _, endpoints := range [][]string{nil, {"http://"}} {
+		if _, err := NewSafeboxClient(&api.Config{}, WithEndpoints(endpoints, nil)); err == nil {
+			t.Fatalf("endpoints %q should be rejected", endpoints)
+		}
+	}
+}
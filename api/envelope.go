@@ -0,0 +1,206 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// envelopePrefix starts every private key sealed by EncryptPrivateKey.
+const envelopePrefix = "sbxenv1:"
+
+// KeyWrapper wraps the data keys protecting private keys with a
+// key-encryption key held by the caller, e.g. in a KMS or HSM.
+type KeyWrapper interface {
+	// WrapKey encrypts dataKey and returns it with the id of the
+	// key-encryption key used.
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey decrypts a data key wrapped by the key-encryption key keyID.
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// WithKeyEncryption makes the client encrypt private keys locally before
+// trusteeing them, and decrypt them after querying them, so that the
+// safebox service never sees raw key material.
+//
+// Each private key is encrypted with AES-256-GCM under a new data key,
+// bound to the user DID, and the data key is wrapped with w. Private keys
+// that were trusteed in plaintext are returned unchanged by QueryPrivateKey.
+func WithKeyEncryption(w KeyWrapper) ClientOption {
+	return func(s *SafeboxClient) {
+		s.keyWrapper = w
+	}
+}
+
+// envelope is the sealed form of a private key.
+type envelope struct {
+	KeyID      string `json:"kid,omitempty"`
+	WrappedKey []byte `json:"wk"`
+	Nonce      []byte `json:"n"`
+	Ciphertext []byte `json:"ct"`
+}
+
+// IsEncryptedPrivateKey reports whether privateKey was sealed by
+// EncryptPrivateKey.
+func IsEncryptedPrivateKey(privateKey string) bool {
+	return strings.HasPrefix(privateKey, envelopePrefix)
+}
+
+// EncryptPrivateKey seals privateKey for userDid under a new data key
+// wrapped with w.
+func EncryptPrivateKey(w KeyWrapper, userDid, privateKey string) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	defer wipe(dataKey)
+
+	nonce, ciphertext, err := seal(dataKey, []byte(privateKey), []byte(userDid))
+	if err != nil {
+		return "", err
+	}
+	keyID, wrapped, err := w.WrapKey(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("wrap data key: %v", err)
+	}
+
+	b, err := json.Marshal(&envelope{
+		KeyID:      keyID,
+		WrappedKey: wrapped,
+		Nonce:      nonce,
+		Ciphertext: ciphertext,
+	})
+	if err != nil {
+		return "", err
+	}
+	return envelopePrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecryptPrivateKey opens a private key sealed for userDid by
+// EncryptPrivateKey.
+func DecryptPrivateKey(w KeyWrapper, userDid, sealed string) (string, error) {
+	if !IsEncryptedPrivateKey(sealed) {
+		return "", fmt.Errorf("private key is not encrypted")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(sealed, envelopePrefix))
+	if err != nil {
+		return "", fmt.Errorf("decode envelope: %v", err)
+	}
+	var env envelope
+	if err = json.Unmarshal(b, &env); err != nil {
+		return "", fmt.Errorf("decode envelope: %v", err)
+	}
+
+	dataKey, err := w.UnwrapKey(env.KeyID, env.WrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("unwrap data key: %v", err)
+	}
+	defer wipe(dataKey)
+
+	plaintext, err := open(dataKey, env.Nonce, env.Ciphertext, []byte(userDid))
+	if err != nil {
+		return "", err
+	}
+	defer wipe(plaintext)
+	return string(plaintext), nil
+}
+
+// aesKeyWrapper wraps data keys with AES-GCM.
+type aesKeyWrapper struct {
+	keyID string
+	kek   []byte
+}
+
+// NewAESKeyWrapper returns a KeyWrapper wrapping data keys with AES-GCM
+// under kek, which must be 16, 24 or 32 bytes long. keyID is stored along
+// with every wrapped key and checked when unwrapping.
+func NewAESKeyWrapper(keyID string, kek []byte) (KeyWrapper, error) {
+	if _, err := aes.NewCipher(kek); err != nil {
+		return nil, err
+	}
+	return &aesKeyWrapper{keyID: keyID, kek: append([]byte(nil), kek...)}, nil
+}
+
+func (w *aesKeyWrapper) WrapKey(dataKey []byte) (string, []byte, error) {
+	nonce, ciphertext, err := seal(w.kek, dataKey, []byte(w.keyID))
+	if err != nil {
+		return "", nil, err
+	}
+	return w.keyID, append(nonce, ciphertext...), nil
+}
+
+func (w *aesKeyWrapper) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	if keyID != w.keyID {
+		return nil, fmt.Errorf("unknown key-encryption key %q", keyID)
+	}
+	gcm, err := newGCM(w.kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+	return open(w.kek, wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():], []byte(keyID))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(key, plaintext, additionalData []byte) (nonce, ciphertext []byte, err error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+func open(key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size")
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %v", err)
+	}
+	return plaintext, nil
+}
+
+// wipe overwrites b with zeros.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/arxanchain/sdk-go-common/rest/api"
+	rtstructs "github.com/arxanchain/sdk-go-common/rest/structs"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func newTestKeyWrapper(t *testing.T, keyID string, seed byte) KeyWrapper {
+	w, err := NewAESKeyWrapper(keyID, bytes.Repeat([]byte{seed}, 32))
+	if err != nil {
+		t.Fatalf("new key wrapper fail: %v", err)
+	}
+	return w
+}
+
+func TestEncryptPrivateKey(t *testing.T) {
+	w := newTestKeyWrapper(t, "kek-1", 1)
+
+	sealed, err := EncryptPrivateKey(w, "did:anx:00001", "privatekey")
+	if err != nil {
+		t.Fatalf("encrypt private key error, %v", err)
+	}
+	if !IsEncryptedPrivateKey(sealed) || strings.Contains(sealed, "privatekey") {
+		t.Fatalf("private key not sealed: %s", sealed)
+	}
+
+	privateKey, err := DecryptPrivateKey(w, "did:anx:00001", sealed)
+	if err != nil {
+		t.Fatalf("decrypt private key error, %v", err)
+	}
+	if privateKey != "privatekey" {
+		t.Fatalf("decrypted private key mismatch")
+	}
+
+	if _, err = DecryptPrivateKey(w, "did:anx:00002", sealed); err == nil {
+		t.Fatalf("private key sealed for another DID should not decrypt")
+	}
+	if _, err = DecryptPrivateKey(newTestKeyWrapper(t, "kek-1", 2), "did:anx:00001", sealed); err == nil {
+		t.Fatalf("private key should not decrypt with another key-encryption key")
+	}
+	if _, err = DecryptPrivateKey(newTestKeyWrapper(t, "kek-2", 1), "did:anx:00001", sealed); err == nil {
+		t.Fatalf("private key should not decrypt with another key id")
+	}
+}
+
+func TestNewAESKeyWrapperInvalidKey(t *testing.T) {
+	if _, err := NewAESKeyWrapper("kek-1", []byte("short")); err == nil {
+		t.Fatalf("invalid key-encryption key should be rejected")
+	}
+}
+
+func TestQueryPrivateKeyDecryptFail(t *testing.T) {
+	sealed, err := EncryptPrivateKey(newTestKeyWrapper(t, "kek-1", 1), "did:anx:00001", "privatekey")
+	if err != nil {
+		t.Fatalf("encrypt private key error, %v", err)
+	}
+	byPayload, err := json.Marshal(&safebox.PrivateKeyReply{PrivateKey: sealed})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{}}
+	gock.InterceptClient(client)
+	defer gock.Off()
+	safeboxClient, err := NewSafeboxClient(&api.Config{Address: safeboxURL, HttpClient: client},
+		WithKeyEncryption(newTestKeyWrapper(t, "kek-1", 2)))
+	if err != nil {
+		t.Fatalf("New safebox client fail: %v", err)
+	}
+
+	//mock http response
+	gock.New(safeboxURL).
+		Get(privateURLPath).
+		Reply(http.StatusOK).
+		JSON(&rtstructs.Response{Payload: string(byPayload)})
+
+	resp, err := safeboxClient.QueryPrivateKey(http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:anx:00001"})
+	if !errors.Is(err, ErrKeyEncryption) {
+		t.Fatalf("expected key encryption error, got %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("query private response is error")
+	}
+}
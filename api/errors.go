@@ -0,0 +1,163 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/arxanchain/sdk-go-common/errors"
+)
+
+// Sentinel errors classifying SafeboxClient failures. Every error returned
+// by a SafeboxClient method is an *Error, which can be tested against these
+// with errors.Is:
+//
+//	_, err := client.QueryPrivateKey(header, info)
+//	if errors.Is(err, api.ErrWrongSecurityCode) {
+//		...
+//	}
+var (
+	// ErrInvalidRequest means the request was rejected before being sent,
+	// or by the service, because its parameters are invalid.
+	ErrInvalidRequest = fmt.Errorf("invalid request")
+	// ErrUserExists means a key pair is already trusteed for the DID.
+	ErrUserExists = fmt.Errorf("user already exists")
+	// ErrWrongSecurityCode means the security code does not match. The
+	// safebox service does not tell a wrong code from an unknown DID: both
+	// are reported as ErrKeyNotFound, and ErrWrongSecurityCode only
+	// classifies a 403 reply that carries no known ErrCode.
+	ErrWrongSecurityCode = fmt.Errorf("security code is wrong")
+	// ErrKeyNotFound means no key pair is trusteed for the DID.
+	ErrKeyNotFound = fmt.Errorf("key pair not found")
+	// ErrUnauthorized means the API key was rejected.
+	ErrUnauthorized = fmt.Errorf("unauthorized api key")
+	// ErrTransport means the service could not be reached or the gateway
+	// failed to answer, including when the request context is done.
+	ErrTransport = fmt.Errorf("transport failure")
+	// ErrMalformedPayload means the reply could not be decoded.
+	ErrMalformedPayload = fmt.Errorf("malformed payload")
+	// ErrIdempotencyKeyReused means the idempotency key was already used
+	// for a different request.
+	ErrIdempotencyKeyReused = fmt.Errorf("idempotency key reused")
+	// ErrKeyEncryption means a private key could not be encrypted or
+	// decrypted locally, see WithKeyEncryption and ExportKeystore.
+	ErrKeyEncryption = fmt.Errorf("private key encryption failed")
+	// ErrKeyMismatch means the key pair read back from the service is not
+	// the one that was trusteed, or the public key of a key pair does not
+	// match its private key, see WithKeyPairVerification.
+	ErrKeyMismatch = fmt.Errorf("key pair mismatch")
+)
+
+// codeKinds maps safebox ErrCode values to sentinel errors. They take
+// precedence over the http status of the reply.
+var codeKinds = map[int]error{
+	int(errors.UserInfoIsExist): ErrUserExists,
+	int(errors.UserInfoNotExit): ErrKeyNotFound,
+}
+
+// statusKinds maps http status codes to sentinel errors, for replies
+// without a known ErrCode, such as those of a gateway in front of the
+// service.
+var statusKinds = map[int]error{
+	http.StatusBadRequest:          ErrInvalidRequest,
+	http.StatusUnauthorized:        ErrUnauthorized,
+	http.StatusForbidden:           ErrWrongSecurityCode,
+	http.StatusNotFound:            ErrKeyNotFound,
+	http.StatusConflict:            ErrUserExists,
+	http.StatusUnprocessableEntity: ErrIdempotencyKeyReused,
+}
+
+// Error is the error returned by SafeboxClient methods.
+type Error struct {
+	// Op is the failed operation, e.g. "QueryPrivateKey".
+	Op string
+	// Kind is the sentinel error classifying the failure, nil if the
+	// failure is not one of the known kinds.
+	Kind error
+	// ErrCode is the ErrCode of the safebox reply, zero if none was decoded.
+	ErrCode int
+	// HTTPStatus is the http status of the reply, zero if none was received.
+	HTTPStatus int
+	// Message is the ErrMessage of the safebox reply.
+	Message string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("safebox")
+	if e.Op != "" {
+		b.WriteString(": " + e.Op)
+	}
+	if e.Kind != nil {
+		b.WriteString(": " + e.Kind.Error())
+	}
+	if e.ErrCode != 0 || e.HTTPStatus != 0 {
+		fmt.Fprintf(&b, " (ErrCode %d, HTTP %d)", e.ErrCode, e.HTTPStatus)
+	}
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+	return b.String()
+}
+
+// Is reports whether target is the sentinel error classifying e.
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Code returns the safebox ErrCode, so that Error also satisfies
+// rest.HTTPCodedError.
+func (e *Error) Code() int {
+	return e.ErrCode
+}
+
+// newError returns an *Error of kind kind wrapping err.
+func newError(op string, kind error, err error) *Error {
+	return &Error{Op: op, Kind: kind, Err: err}
+}
+
+// newServiceError returns the *Error for a safebox reply with the given http
+// status, ErrCode and ErrMessage.
+func newServiceError(op string, status int, code int, msg string) *Error {
+	kind, ok := codeKinds[code]
+	if !ok {
+		kind, ok = statusKinds[status]
+	}
+	if !ok && status >= http.StatusInternalServerError {
+		kind = ErrTransport
+	}
+	return &Error{
+		Op:         op,
+		Kind:       kind,
+		ErrCode:    code,
+		HTTPStatus: status,
+		Message:    msg,
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"testing"
+
+	"github.com/arxanchain/sdk-go-common/errors"
+	"github.com/arxanchain/sdk-go-common/rest"
+	rtstructs "github.com/arxanchain/sdk-go-common/rest/structs"
+	"github.com/arxanchain/sdk-go-common/structs"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestErrorUserExists(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+
+	respBody := &rtstructs.Response{
+		ErrCode:    errors.UserInfoIsExist,
+		ErrMessage: "user exist",
+	}
+	//mock http response
+	gock.New(safeboxURL).
+		Post(trusteeURLPath).
+		Reply(http.StatusOK).
+		JSON(respBody)
+
+	header := http.Header{}
+	header.Set(structs.APIKeyHeader, apiKey)
+
+	req := &safebox.SaveKeyPairRequetBody{
+		UserDid:    "did:anx:00001",
+		PrivateKey: "privatekey",
+		PublicKey:  "publckey",
+	}
+
+	_, err := safeboxClient.TrusteeKeyPair(header, req)
+	if !stderrors.Is(err, ErrUserExists) {
+		t.Fatalf("expected user exists error, got %v", err)
+	}
+	var e *Error
+	if !stderrors.As(err, &e) {
+		t.Fatalf("expected *Error, got %T", err)
+	}
+	if e.Op != OpTrusteeKeyPair || e.ErrCode != int(errors.UserInfoIsExist) ||
+		e.HTTPStatus != http.StatusOK || e.Message != "user exist" {
+		t.Fatalf("unexpected error fields: %+v", e)
+	}
+	if coded, ok := err.(rest.HTTPCodedError); !ok || coded.Code() != int(errors.UserInfoIsExist) {
+		t.Fatalf("error should keep the safebox ErrCode")
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	cases := []struct {
+		status int
+		kind   error
+	}{
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrWrongSecurityCode},
+		{http.StatusNotFound, ErrKeyNotFound},
+		{http.StatusBadGateway, ErrTransport},
+		{http.StatusServiceUnavailable, ErrTransport},
+	}
+
+	for _, c := range cases {
+		initTestSafeboxClient(t)
+
+		//mock http response
+		gock.New(safeboxURL).
+			Get(publicURLPath).
+			Reply(c.status).
+			BodyString("gateway says no")
+
+		_, err := safeboxClient.QueryPublicKey(http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:anx:00001"})
+		gock.Off()
+		if !stderrors.Is(err, c.kind) {
+			t.Fatalf("status %d: expected %v, got %v", c.status, c.kind, err)
+		}
+		var e *Error
+		if !stderrors.As(err, &e) || e.HTTPStatus != c.status {
+			t.Fatalf("status %d: http status not kept in %v", c.status, err)
+		}
+	}
+}
+
+func TestErrorCodePrecedence(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+
+	respBody := &rtstructs.Response{
+		ErrCode:    errors.UserInfoNotExit,
+		ErrMessage: "user does not exist",
+	}
+	//mock http response
+	gock.New(safeboxURL).
+		Get(privateURLPath).
+		Reply(http.StatusForbidden).
+		JSON(respBody)
+
+	_, err := safeboxClient.QueryPrivateKey(http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:anx:00001", Code: "wrong"})
+	if !stderrors.Is(err, ErrKeyNotFound) || stderrors.Is(err, ErrWrongSecurityCode) {
+		t.Fatalf("ErrCode should classify the error, got %v", err)
+	}
+}
+
+func TestErrorKeyNotFound(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+
+	respBody := &rtstructs.Response{
+		ErrCode:    errors.UserInfoNotExit,
+		ErrMessage: "user does not exist",
+	}
+	//mock http response
+	gock.New(safeboxURL).
+		Get(recoverCodeURLPath).
+		Reply(http.StatusOK).
+		JSON(respBody)
+
+	_, err := safeboxClient.RecoverAssistCode(http.Header{}, "did:anx:00001")
+	if !stderrors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected key not found error, got %v", err)
+	}
+}
+
+func TestErrorMalformedPayload(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+
+	respBody := &rtstructs.Response{
+		ErrCode: 0,
+		Payload: "{not json",
+	}
+	//mock http response
+	gock.New(safeboxURL).
+		Get(privateURLPath).
+		Reply(http.StatusOK).
+		JSON(respBody)
+
+	resp, err := safeboxClient.QueryPrivateKey(http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:anx:00001"})
+	if !stderrors.Is(err, ErrMalformedPayload) {
+		t.Fatalf("expected malformed payload error, got %v", err)
+	}
+	var syntaxErr *json.SyntaxError
+	if !stderrors.As(err, &syntaxErr) {
+		t.Fatalf("underlying json error should be kept, got %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("query private response is error")
+	}
+}
+
+func TestErrorInvalidRequest(t *testing.T) {
+	initTestSafeboxClient(t)
+
+	err := safeboxClient.DeleteKeyPair(http.Header{}, nil)
+	if !stderrors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected invalid request error, got %v", err)
+	}
+}
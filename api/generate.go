@@ -0,0 +1,160 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+
+	"github.com/arxanchain/safebox-sdk-go/keyfmt"
+	"github.com/arxanchain/sdk-go-common/structs/did"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// KeyType is the algorithm of a key pair.
+type KeyType string
+
+// Key types supported by GenerateKeyPair. Their encodings are the
+// keyfmt.Base64 encodings of the matching keyfmt.Algorithm.
+const (
+	// KeyTypeEd25519 keys are encoded as the base64 of the 64 bytes
+	// ed25519 private key (seed followed by public key) and of the 32 bytes
+	// public key.
+	KeyTypeEd25519 KeyType = "ed25519"
+	// KeyTypeP256 keys are encoded as the base64 of the 32 bytes private
+	// scalar and of the 33 bytes compressed public key.
+	KeyTypeP256 KeyType = "P-256"
+	// KeyTypeSecp256k1 keys are encoded as the base64 of the 32 bytes
+	// private scalar and of the 33 bytes compressed public key.
+	KeyTypeSecp256k1 KeyType = "secp256k1"
+)
+
+// algorithm returns the keyfmt algorithm of kt, empty if kt is empty.
+func (kt KeyType) algorithm() (keyfmt.Algorithm, error) {
+	switch kt {
+	case "":
+		return "", nil
+	case KeyTypeEd25519:
+		return keyfmt.Ed25519, nil
+	case KeyTypeP256:
+		return keyfmt.P256, nil
+	case KeyTypeSecp256k1:
+		return keyfmt.Secp256k1, nil
+	}
+	return "", fmt.Errorf("unsupported key type %q", kt)
+}
+
+// keyType returns the KeyType of alg.
+func keyType(alg keyfmt.Algorithm) KeyType {
+	switch alg {
+	case keyfmt.Ed25519:
+		return KeyTypeEd25519
+	case keyfmt.P256:
+		return KeyTypeP256
+	default:
+		return KeyTypeSecp256k1
+	}
+}
+
+// GeneratedKeyPair is the result of GenerateAndTrustee.
+type GeneratedKeyPair struct {
+	UserDid did.Identifier
+	KeyType KeyType
+	// PublicKey is the encoded public key, see KeyType.
+	PublicKey string
+	// Code is the security code protecting the trusteed key pair.
+	Code string
+}
+
+// GenerateKeyPair returns a new key pair of type kt, encoded as expected
+// by the safebox service.
+func GenerateKeyPair(kt KeyType) (privateKey, publicKey string, err error) {
+	var priv crypto.PrivateKey
+	switch kt {
+	case KeyTypeEd25519:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	case KeyTypeP256:
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeSecp256k1:
+		var k *secp256k1.PrivateKey
+		if k, err = secp256k1.GeneratePrivateKey(); err == nil {
+			// keyfmt holds a copy of the key
+			defer k.Zero()
+			priv = k
+		}
+	default:
+		err = fmt.Errorf("unsupported key type %q", kt)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	key, err := keyfmt.NewPrivateKey(priv)
+	if err != nil {
+		return "", "", err
+	}
+	defer key.Destroy()
+	b, err := key.Encode(keyfmt.Base64)
+	if err != nil {
+		return "", "", err
+	}
+	defer wipe(b)
+	pub, err := key.Public().Encode(keyfmt.Base64)
+	if err != nil {
+		return "", "", err
+	}
+	return string(b), string(pub), nil
+}
+
+// GenerateAndTrustee generates a key pair of type kt and trustees it for
+// id. The private key never leaves the safebox: only the public key and
+// the security code are returned.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) GenerateAndTrustee(ctx context.Context, header http.Header, id did.Identifier, kt KeyType) (*GeneratedKeyPair, error) {
+	if id == "" {
+		return nil, newError(OpTrusteeKeyPair, ErrInvalidRequest, fmt.Errorf("request information is empty"))
+	}
+
+	privateKey, publicKey, err := GenerateKeyPair(kt)
+	if err != nil {
+		return nil, newError(OpTrusteeKeyPair, ErrInvalidRequest, err)
+	}
+
+	reply, err := s.TrusteeKeyPairWithContext(ctx, header, &safebox.SaveKeyPairRequetBody{
+		UserDid:    string(id),
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &GeneratedKeyPair{
+		UserDid:   id,
+		KeyType:   kt,
+		PublicKey: publicKey,
+		Code:      reply.Code,
+	}, nil
+}
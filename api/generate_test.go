@@ -0,0 +1,109 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func decodeKey(t *testing.T, s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("key is not base64: %v", err)
+	}
+	return b
+}
+
+func TestGenerateKeyPairEd25519(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair(KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	priv := ed25519.PrivateKey(decodeKey(t, privateKey))
+	pub := decodeKey(t, publicKey)
+	if len(priv) != ed25519.PrivateKeySize || len(pub) != ed25519.PublicKeySize {
+		t.Fatalf("invalid ed25519 key sizes")
+	}
+	if !bytes.Equal(priv.Public().(ed25519.PublicKey), pub) {
+		t.Fatalf("ed25519 public key does not match private key")
+	}
+}
+
+func TestGenerateKeyPairSecp256k1(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair(KeyTypeSecp256k1)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	priv := secp256k1.PrivKeyFromBytes(decodeKey(t, privateKey))
+	if !bytes.Equal(priv.PubKey().SerializeCompressed(), decodeKey(t, publicKey)) {
+		t.Fatalf("secp256k1 public key does not match private key")
+	}
+}
+
+func TestGenerateKeyPairP256(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair(KeyTypeP256)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	priv, err := ecdh.P256().NewPrivateKey(decodeKey(t, privateKey))
+	if err != nil {
+		t.Fatalf("parse P-256 private key error, %v", err)
+	}
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), decodeKey(t, publicKey))
+	if x == nil || !bytes.Equal(priv.PublicKey().Bytes(), elliptic.Marshal(elliptic.P256(), x, y)) {
+		t.Fatalf("P-256 public key does not match private key")
+	}
+}
+
+func TestGenerateKeyPairUnsupported(t *testing.T) {
+	if _, _, err := GenerateKeyPair("rsa"); err == nil {
+		t.Fatalf("unsupported key type should fail")
+	}
+}
+
+func TestGenerateAndTrustee(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+	var sent safebox.SaveKeyPairRequetBody
+	mockPayload(t, gock.New(safeboxURL).Post(trusteeURLPath).AddMatcher(decodeBody(&sent)), &safebox.SaveKeyPairReply{Code: "我是中国人"})
+
+	kp, err := safeboxClient.GenerateAndTrustee(context.Background(), http.Header{}, "did:anx:00001", KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("generate and trustee error, %v", err)
+	}
+	if kp.Code != "我是中国人" || kp.UserDid != "did:anx:00001" || kp.KeyType != KeyTypeEd25519 {
+		t.Fatalf("generate and trustee result error: %+v", kp)
+	}
+	if sent.UserDid != "did:anx:00001" || sent.PublicKey != kp.PublicKey || sent.PrivateKey == "" {
+		t.Fatalf("trusteed key pair mismatch: %+v", sent)
+	}
+
+	if _, err = safeboxClient.GenerateAndTrustee(context.Background(), http.Header{}, "", KeyTypeEd25519); err == nil {
+		t.Fatalf("empty DID should fail")
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/arxanchain/safebox-sdk-go/api/internal/fingerprint"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// IdempotencyKeyHeader is the header carrying the idempotency key of a
+// request. Write operations are only retried when it is set.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// replayCacheSize is the number of trustee replies remembered per client.
+const replayCacheSize = 1024
+
+// NewIdempotencyKey returns a new random idempotency key.
+func NewIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("read random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// SetIdempotencyKey sets key as the idempotency key of the request sent
+// with header.
+//
+// When a TrusteeKeyPair request carrying a key times out, it can be sent
+// again with the same key and body: the original SaveKeyPairReply, with
+// its security code, is returned instead of an ErrUserExists error. Sending
+// the same key with another body fails with ErrIdempotencyKeyReused.
+//
+// The client remembers the replies in memory, for the last 1024 keys: a
+// replay through another client, or after the process restarted, is sent
+// to the service and only succeeds if the service honours the key itself.
+func SetIdempotencyKey(header http.Header, key string) {
+	header.Set(IdempotencyKeyHeader, key)
+}
+
+type replay struct {
+	fingerprint string
+	reply       safebox.SaveKeyPairReply
+}
+
+// replayCache remembers the replies of the trustee requests made with an
+// idempotency key, so that replays through the same client are answered
+// without reaching the service. It lives in the client process only and is
+// lost when the process exits.
+type replayCache struct {
+	mu      sync.Mutex
+	replays map[string]*replay
+	keys    []string
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{replays: make(map[string]*replay)}
+}
+
+// lookup returns the reply stored for key, or an error if key was used for
+// another body. Both are nil if key is unknown.
+func (c *replayCache) lookup(key string, body *safebox.SaveKeyPairRequetBody) (*safebox.SaveKeyPairReply, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.replays[key]
+	if !ok {
+		return nil, nil
+	}
+	if r.fingerprint != fingerprint.Trustee(body) {
+		return nil, newError(OpTrusteeKeyPair, ErrIdempotencyKeyReused, nil)
+	}
+	reply := r.reply
+	return &reply, nil
+}
+
+func (c *replayCache) store(key string, body *safebox.SaveKeyPairRequetBody, reply *safebox.SaveKeyPairReply) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.replays[key]; ok {
+		return
+	}
+	if len(c.keys) >= replayCacheSize {
+		delete(c.replays, c.keys[0])
+		c.keys = c.keys[1:]
+	}
+	c.keys = append(c.keys, key)
+	c.replays[key] = &replay{fingerprint: fingerprint.Trustee(body), reply: *reply}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestTrusteeKeyPairReplay(t *testing.T) {
+	initTestSafeboxClient(t, WithRetryPolicy(testRetryPolicy))
+	defer gock.Off()
+	client := safeboxClient
+
+	// A single reply: a replay reaching the service would fail
+	mockPayload(t, gock.New(safeboxURL).Post(trusteeURLPath), &safebox.SaveKeyPairReply{Code: "我是中国人"})
+
+	header := http.Header{}
+	SetIdempotencyKey(header, NewIdempotencyKey())
+	body := &safebox.SaveKeyPairRequetBody{
+		UserDid:    "did:anx:00001",
+		PrivateKey: "privatekey",
+		PublicKey:  "publickey",
+	}
+
+	first, err := client.TrusteeKeyPair(header, body)
+	if err != nil {
+		t.Fatalf("trustee key pair error, %v", err)
+	}
+	replayed, err := client.TrusteeKeyPair(header, body)
+	if err != nil {
+		t.Fatalf("trustee key pair replay error, %v", err)
+	}
+	if replayed.Code != first.Code {
+		t.Fatalf("replay should return the original code")
+	}
+
+	other := *body
+	other.PublicKey = "otherkey"
+	if _, err = client.TrusteeKeyPair(header, &other); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("expected idempotency key reused error, got %v", err)
+	}
+}
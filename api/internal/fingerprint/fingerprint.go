@@ -0,0 +1,38 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fingerprint identifies the requests sent with an idempotency key,
+// for the safebox client and its fake service.
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// Trustee returns the fingerprint identifying body among the requests sent
+// with the same idempotency key. The private key is left out: it may be
+// encrypted with a random nonce, and must not leak through the fingerprint.
+func Trustee(body *safebox.SaveKeyPairRequetBody) string {
+	h := sha256.New()
+	for _, field := range []string{body.UserDid, body.PublicKey} {
+		fmt.Fprintf(h, "%d:%s", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
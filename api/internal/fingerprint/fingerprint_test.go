@@ -0,0 +1,36 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fingerprint
+
+import (
+	"testing"
+
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+func TestTrustee(t *testing.T) {
+	a := Trustee(&safebox.SaveKeyPairRequetBody{UserDid: "ab", PublicKey: "c"})
+	b := Trustee(&safebox.SaveKeyPairRequetBody{UserDid: "a", PublicKey: "bc"})
+	if a == b {
+		t.Fatalf("fingerprints of different bodies should differ")
+	}
+
+	c := Trustee(&safebox.SaveKeyPairRequetBody{UserDid: "ab", PublicKey: "c", PrivateKey: "secret"})
+	if a != c {
+		t.Fatalf("fingerprint should not depend on the private key")
+	}
+}
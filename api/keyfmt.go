@@ -0,0 +1,94 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/arxanchain/safebox-sdk-go/keyfmt"
+	"github.com/arxanchain/sdk-go-common/structs/did"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// TrusteeTypedKeyPair trustees key for id, sending its private and public
+// keys encoded in format, keyfmt.Base64 if empty.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) TrusteeTypedKeyPair(ctx context.Context, header http.Header, id did.Identifier, key *keyfmt.PrivateKey, format keyfmt.Format) (*safebox.SaveKeyPairReply, error) {
+	if id == "" || key == nil {
+		return nil, newError(OpTrusteeKeyPair, ErrInvalidRequest, fmt.Errorf("request information is empty"))
+	}
+	if format == "" {
+		format = keyfmt.Base64
+	}
+
+	privateKey, err := key.Encode(format)
+	if err != nil {
+		return nil, newError(OpTrusteeKeyPair, ErrInvalidRequest, err)
+	}
+	defer wipe(privateKey)
+	publicKey, err := key.Public().Encode(format)
+	if err != nil {
+		return nil, newError(OpTrusteeKeyPair, ErrInvalidRequest, err)
+	}
+
+	return s.TrusteeKeyPairWithContext(ctx, header, &safebox.SaveKeyPairRequetBody{
+		UserDid:    string(id),
+		PrivateKey: string(privateKey),
+		PublicKey:  string(publicKey),
+	})
+}
+
+// QueryTypedPrivateKey queries the private key of info and parses it,
+// whatever format it was trusteed in. alg is required for raw keys whose
+// size does not tell the algorithm, see keyfmt.ParsePrivateKey. Encode
+// the returned key to get it in another format, and Destroy it once done.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) QueryTypedPrivateKey(ctx context.Context, header http.Header, info *safebox.OperateKeyInfo, alg keyfmt.Algorithm) (*keyfmt.PrivateKey, error) {
+	secret, err := s.QueryPrivateKeySecret(ctx, header, info)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.Destroy()
+
+	key, _, err := keyfmt.ParsePrivateKey(secret.Bytes(), alg)
+	if err != nil {
+		return nil, newError(OpQueryPrivateKey, ErrMalformedPayload, err)
+	}
+	return key, nil
+}
+
+// QueryTypedPublicKey queries the public key of info and parses it,
+// whatever format it was trusteed in. alg is required for raw compressed
+// ECDSA keys, see keyfmt.ParsePublicKey.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) QueryTypedPublicKey(ctx context.Context, header http.Header, info *safebox.OperateKeyInfo, alg keyfmt.Algorithm) (*keyfmt.PublicKey, error) {
+	reply, err := s.QueryPublicKeyWithContext(ctx, header, info)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _, err := keyfmt.ParsePublicKey([]byte(reply.PublicKey), alg)
+	if err != nil {
+		return nil, newError(OpQueryPublicKey, ErrMalformedPayload, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"testing"
+
+	"github.com/arxanchain/safebox-sdk-go/keyfmt"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestTrusteeTypedKeyPair(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+	client := safeboxClient
+	var body safebox.SaveKeyPairRequetBody
+	mockPayload(t, gock.New(safeboxURL).Post(trusteeURLPath).AddMatcher(decodeBody(&body)).Times(2), &safebox.SaveKeyPairReply{Code: "code"})
+
+	priv, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("generate key error, %v", err)
+	}
+	key, err := keyfmt.NewPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("NewPrivateKey error, %v", err)
+	}
+
+	if _, err := client.TrusteeTypedKeyPair(context.Background(), http.Header{}, "did:1", key, keyfmt.PEM); err != nil {
+		t.Fatalf("trustee typed key pair error, %v", err)
+	}
+	if f := keyfmt.Detect([]byte(body.PrivateKey)); f != keyfmt.PEM {
+		t.Fatalf("private key sent as %q", f)
+	}
+	pub, _, err := keyfmt.ParsePublicKey([]byte(body.PublicKey), "")
+	if err != nil || !pub.Equal(key.Public()) {
+		t.Fatalf("public key sent does not match, %v", err)
+	}
+
+	// The default format is the one of GenerateKeyPair
+	if _, err := client.TrusteeTypedKeyPair(context.Background(), http.Header{}, "did:1", key, ""); err != nil {
+		t.Fatalf("trustee typed key pair error, %v", err)
+	}
+	if want := base64PublicKey(t, key); body.PublicKey != want {
+		t.Fatalf("public key sent as %q, want %q", body.PublicKey, want)
+	}
+}
+
+func base64PublicKey(t *testing.T, key *keyfmt.PrivateKey) string {
+	b, err := key.Public().Encode(keyfmt.Base64)
+	if err != nil {
+		t.Fatalf("Encode error, %v", err)
+	}
+	return string(b)
+}
+
+func TestQueryTypedKeys(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair(KeyTypeSecp256k1)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	initTestSafeboxClient(t)
+	defer gock.Off()
+	client := safeboxClient
+	mockPayload(t, gock.New(safeboxURL).Get(privateURLPath).Times(2), &safebox.PrivateKeyReply{PrivateKey: privateKey})
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath), &safebox.PublicKeyReply{PublicKey: publicKey})
+
+	info := &safebox.OperateKeyInfo{UserDid: "did:1", Code: "code"}
+
+	// A raw 32 bytes private key needs the algorithm
+	_, err = client.QueryTypedPrivateKey(context.Background(), http.Header{}, info, "")
+	if !stderrors.Is(err, ErrMalformedPayload) || !stderrors.Is(err, keyfmt.ErrAmbiguousAlgorithm) {
+		t.Fatalf("expected ErrMalformedPayload, got %v", err)
+	}
+	key, err := client.QueryTypedPrivateKey(context.Background(), http.Header{}, info, keyfmt.Secp256k1)
+	if err != nil {
+		t.Fatalf("query typed private key error, %v", err)
+	}
+	defer key.Destroy()
+
+	pub, err := client.QueryTypedPublicKey(context.Background(), http.Header{}, info, keyfmt.Secp256k1)
+	if err != nil {
+		t.Fatalf("query typed public key error, %v", err)
+	}
+	if !pub.Equal(key.Public()) {
+		t.Fatalf("public key does not match private key")
+	}
+	if got := base64PublicKey(t, key); got != publicKey {
+		t.Fatalf("public key encoded as %q, want %q", got, publicKey)
+	}
+}
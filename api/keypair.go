@@ -17,101 +17,137 @@ limitations under the License.
 package api
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
-	"reflect"
 
-	"github.com/arxanchain/sdk-go-common/errors"
-	"github.com/arxanchain/sdk-go-common/rest"
-	restapi "github.com/arxanchain/sdk-go-common/rest/api"
-	reststruct "github.com/arxanchain/sdk-go-common/rest/structs"
 	safebox "github.com/arxanchain/sdk-go-common/structs/safebox"
 )
 
 // TrusteeKeyPair is used to trutee keypair.
 //
-// API-Key must set to header.
+// API-Key must set to header. An idempotency key may be set with
+// SetIdempotencyKey to make the request safe to replay.
 func (s *SafeboxClient) TrusteeKeyPair(header http.Header, body *safebox.SaveKeyPairRequetBody) (result *safebox.SaveKeyPairReply, err error) {
+	return s.TrusteeKeyPairWithContext(context.Background(), header, body)
+}
+
+// TrusteeKeyPairWithContext is like TrusteeKeyPair but binds the request to ctx.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) TrusteeKeyPairWithContext(ctx context.Context, header http.Header, body *safebox.SaveKeyPairRequetBody) (result *safebox.SaveKeyPairReply, err error) {
 	if body == nil {
-		err = fmt.Errorf("request payload is null")
+		err = newError(OpTrusteeKeyPair, ErrInvalidRequest, fmt.Errorf("request payload is null"))
 		return
 	}
+	defer s.InvalidatePublicKey(body.UserDid)
 
-	// Build http request
-	r := s.c.NewRequest("POST", "/v1/keypair/save")
-	r.SetHeaders(header)
-	r.SetBody(body)
-
-	// Do http request
-	_, resp, err := restapi.RequireOK(s.c.DoRequest(r))
-	if err != nil {
-		return
+	// Replay of a request already answered
+	key := header.Get(IdempotencyKeyHeader)
+	if key != "" {
+		result, err = s.replays.lookup(key, body)
+		if result != nil || err != nil {
+			return
+		}
 	}
-	defer resp.Body.Close()
 
-	// Parse http response
-	var respBody reststruct.Response
-	if err = restapi.DecodeBody(resp, &respBody); err != nil {
-		return
+	// Check the public key matches the private key
+	if s.verifyKeyPairs && !IsEncryptedPrivateKey(body.PrivateKey) {
+		if verifyErr := verifyKeyPair(body.PrivateKey, body.PublicKey); verifyErr != nil {
+			err = newError(OpTrusteeKeyPair, ErrKeyMismatch, verifyErr)
+			return
+		}
 	}
 
-	if respBody.ErrCode != errors.SuccCode {
-		err = rest.CodedError(respBody.ErrCode, respBody.ErrMessage)
-		return
+	// Encrypt private key locally
+	sent := body
+	if s.keyWrapper != nil && !IsEncryptedPrivateKey(body.PrivateKey) {
+		sealed, encErr := EncryptPrivateKey(s.keyWrapper, body.UserDid, body.PrivateKey)
+		if encErr != nil {
+			err = newError(OpTrusteeKeyPair, ErrKeyEncryption, encErr)
+			return
+		}
+		encrypted := *body
+		encrypted.PrivateKey = sealed
+		sent = &encrypted
 	}
 
-	payload, ok := respBody.Payload.(string)
-	if !ok {
-		err = fmt.Errorf("response payload type invalid: %v", reflect.TypeOf(respBody.Payload))
+	// Build http request
+	req := &request{
+		op:      OpTrusteeKeyPair,
+		userDid: body.UserDid,
+		input:   body,
+		method:  "POST",
+		path:    "/v1/keypair/save",
+		body:    sent,
+	}
+
+	// Do http request and parse http response
+	var reply safebox.SaveKeyPairReply
+	err = s.invoke(ctx, header, req, func(resp *http.Response) (interface{}, error) {
+		return &reply, decodePayload(OpTrusteeKeyPair, resp, &reply)
+	})
+	if err != nil {
 		return
 	}
-
-	err = json.Unmarshal([]byte(payload), &result)
+	result = &reply
+	if key != "" {
+		s.replays.store(key, body, result)
+	}
 
 	return
 }
 
 // QueryPrivateKey is used to query private key.
 //
-// API-Key must set to header.
+// API-Key must set to header. Private keys encrypted by the client, see
+// WithKeyEncryption, are decrypted before being returned.
 func (s *SafeboxClient) QueryPrivateKey(header http.Header, info *safebox.OperateKeyInfo) (result *safebox.PrivateKeyReply, err error) {
+	return s.QueryPrivateKeyWithContext(context.Background(), header, info)
+}
+
+// QueryPrivateKeyWithContext is like QueryPrivateKey but binds the request to ctx.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) QueryPrivateKeyWithContext(ctx context.Context, header http.Header, info *safebox.OperateKeyInfo) (result *safebox.PrivateKeyReply, err error) {
 	if info == nil {
-		err = fmt.Errorf("request information is nil")
+		err = newError(OpQueryPrivateKey, ErrInvalidRequest, fmt.Errorf("request information is nil"))
 		return
 	}
 
 	// Build http request
-	r := s.c.NewRequest("GET", "/v1/keypair/private")
-	r.SetHeaders(header)
-	r.SetParam("user_did", info.UserDid)
-	r.SetParam("code", info.Code)
-
-	// Do http request
-	_, resp, err := restapi.RequireOK(s.c.DoRequest(r))
+	req := &request{
+		op:      OpQueryPrivateKey,
+		userDid: info.UserDid,
+		input:   info,
+		method:  "GET",
+		path:    "/v1/keypair/private",
+		params: map[string]string{
+			"user_did": info.UserDid,
+			"code":     info.Code,
+		},
+		safe: true,
+	}
+
+	// Do http request and parse http response
+	var reply safebox.PrivateKeyReply
+	err = s.invoke(ctx, header, req, func(resp *http.Response) (interface{}, error) {
+		return &reply, decodePayload(OpQueryPrivateKey, resp, &reply)
+	})
 	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
 
-	// Parse http response
-	var respBody reststruct.Response
-	if err = restapi.DecodeBody(resp, &respBody); err != nil {
-		return
+	// Decrypt private key encrypted locally
+	if s.keyWrapper != nil && IsEncryptedPrivateKey(reply.PrivateKey) {
+		privateKey, decErr := DecryptPrivateKey(s.keyWrapper, info.UserDid, reply.PrivateKey)
+		if decErr != nil {
+			err = newError(OpQueryPrivateKey, ErrKeyEncryption, decErr)
+			return
+		}
+		reply.PrivateKey = privateKey
 	}
-
-	if respBody.ErrCode != errors.SuccCode {
-		err = rest.CodedError(respBody.ErrCode, respBody.ErrMessage)
-		return
-	}
-
-	payload, ok := respBody.Payload.(string)
-	if !ok {
-		err = fmt.Errorf("response payload type invalid: %v", reflect.TypeOf(respBody.Payload))
-		return
-	}
-
-	err = json.Unmarshal([]byte(payload), &result)
+	result = &reply
 	return
 }
 
@@ -119,42 +155,52 @@ func (s *SafeboxClient) QueryPrivateKey(header http.Header, info *safebox.Operat
 //
 // API-Key must set to header.
 func (s *SafeboxClient) QueryPublicKey(header http.Header, info *safebox.OperateKeyInfo) (result *safebox.PublicKeyReply, err error) {
-	if info == nil {
-		err = fmt.Errorf("request information is nil")
-		return
-	}
-
-	// Build http request
-	r := s.c.NewRequest("GET", "/v1/keypair/public")
-	r.SetHeaders(header)
-	r.SetParam("user_did", info.UserDid)
-	r.SetParam("code", info.Code)
+	return s.QueryPublicKeyWithContext(context.Background(), header, info)
+}
 
-	// Do http request
-	_, resp, err := restapi.RequireOK(s.c.DoRequest(r))
-	if err != nil {
+// QueryPublicKeyWithContext is like QueryPublicKey but binds the request to ctx.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) QueryPublicKeyWithContext(ctx context.Context, header http.Header, info *safebox.OperateKeyInfo) (result *safebox.PublicKeyReply, err error) {
+	if info == nil {
+		err = newError(OpQueryPublicKey, ErrInvalidRequest, fmt.Errorf("request information is nil"))
 		return
 	}
-	defer resp.Body.Close()
 
-	// Parse http response
-	var respBody reststruct.Response
-	if err = restapi.DecodeBody(resp, &respBody); err != nil {
-		return
+	if s.publicKeys != nil {
+		return s.publicKeys.get(ctx, newCacheKey(header, info), func(ctx context.Context) (*safebox.PublicKeyReply, error) {
+			return s.queryPublicKey(ctx, header, info)
+		})
 	}
+	return s.queryPublicKey(ctx, header, info)
+}
 
-	if respBody.ErrCode != errors.SuccCode {
-		err = rest.CodedError(respBody.ErrCode, respBody.ErrMessage)
-		return
-	}
+// queryPublicKey queries the public key from the service.
+func (s *SafeboxClient) queryPublicKey(ctx context.Context, header http.Header, info *safebox.OperateKeyInfo) (result *safebox.PublicKeyReply, err error) {
 
-	payload, ok := respBody.Payload.(string)
-	if !ok {
-		err = fmt.Errorf("response payload type invalid: %v", reflect.TypeOf(respBody.Payload))
+	// Build http request
+	req := &request{
+		op:      OpQueryPublicKey,
+		userDid: info.UserDid,
+		input:   info,
+		method:  "GET",
+		path:    "/v1/keypair/public",
+		params: map[string]string{
+			"user_did": info.UserDid,
+			"code":     info.Code,
+		},
+		safe: true,
+	}
+
+	// Do http request and parse http response
+	var reply safebox.PublicKeyReply
+	err = s.invoke(ctx, header, req, func(resp *http.Response) (interface{}, error) {
+		return &reply, decodePayload(OpQueryPublicKey, resp, &reply)
+	})
+	if err != nil {
 		return
 	}
-
-	err = json.Unmarshal([]byte(payload), &result)
+	result = &reply
 	return
 }
 
@@ -162,27 +208,46 @@ func (s *SafeboxClient) QueryPublicKey(header http.Header, info *safebox.Operate
 //
 // API-Key must set to header.
 func (s *SafeboxClient) DeleteKeyPair(header http.Header, body *safebox.OperateKeyInfo) error {
+	return s.DeleteKeyPairWithContext(context.Background(), header, body)
+}
+
+// DeleteKeyPairWithContext is like DeleteKeyPair but binds the request to ctx.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) DeleteKeyPairWithContext(ctx context.Context, header http.Header, body *safebox.OperateKeyInfo) error {
+	_, err := s.DeleteKeyPairConfirmed(ctx, header, body)
+	return err
+}
+
+// DeleteKeyPairConfirmed is like DeleteKeyPairWithContext but also
+// returns the confirmation sent by the service.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) DeleteKeyPairConfirmed(ctx context.Context, header http.Header, body *safebox.OperateKeyInfo) (result *Confirmation, err error) {
 	if body == nil {
-		err := fmt.Errorf("request payload is nil")
-		return err
+		err = newError(OpDeleteKeyPair, ErrInvalidRequest, fmt.Errorf("request payload is nil"))
+		return
 	}
+	defer s.InvalidatePublicKey(body.UserDid)
 
 	// Build http request
-	r := s.c.NewRequest("POST", "/v1/keypair/delete")
-	r.SetHeaders(header)
-	r.SetBody(body)
-
-	// Do http request
-	_, resp, err := restapi.RequireOK(s.c.DoRequest(r))
+	req := &request{
+		op:      OpDeleteKeyPair,
+		userDid: body.UserDid,
+		input:   body,
+		method:  "POST",
+		path:    "/v1/keypair/delete",
+		body:    body,
+	}
+
+	// Do http request and parse http response
+	err = s.invoke(ctx, header, req, func(resp *http.Response) (interface{}, error) {
+		var decErr error
+		result, decErr = decodeConfirmation(OpDeleteKeyPair, resp)
+		return result, decErr
+	})
 	if err != nil {
-		return err
+		result = nil
 	}
-	defer resp.Body.Close()
-
-	// Parse http response
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("delete key pair error")
-	}
-
-	return nil
+	return
 }
@@ -17,6 +17,7 @@ limitations under the License.
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -415,10 +416,47 @@ func TestDeleteKeyPairSucc(t *testing.T) {
 		Code:    "我是中国人",
 	}
 
-	err := safeboxClient.DeleteKeyPair(header, req)
+	resp, err := safeboxClient.DeleteKeyPairConfirmed(context.Background(), header, req)
 	if err != nil {
 		t.Fatalf("delete key pair error, %v", err)
 	}
+	if resp == nil || resp.Payload != "" {
+		t.Fatalf("delete key pair response error")
+	}
+}
+
+func TestDeleteKeyPairErrCode(t *testing.T) {
+	initTestSafeboxClient(t)
+	defer gock.Off()
+
+	respBody := &rtstructs.Response{
+		ErrCode:    errors.UserInfoNotExit,
+		ErrMessage: "user does not exist",
+	}
+	//mock http response
+	gock.New(safeboxURL).
+		Post(deleteURLPath).
+		Reply(http.StatusOK).
+		JSON(respBody)
+
+	header := http.Header{}
+	header.Set(structs.APIKeyHeader, apiKey)
+
+	req := &safebox.OperateKeyInfo{
+		UserDid: "did:anx:00001",
+		Code:    "我是中国人",
+	}
+
+	resp, err := safeboxClient.DeleteKeyPairConfirmed(context.Background(), header, req)
+	if err == nil {
+		t.Fatalf("delete key pair should fail on ErrCode")
+	}
+	if resp != nil {
+		t.Fatalf("delete key pair response is error")
+	}
+	if e, ok := err.(*Error); !ok || e.ErrCode != int(errors.UserInfoNotExit) || e.Message != "user does not exist" {
+		t.Fatalf("delete key pair error does not keep ErrCode: %v", err)
+	}
 }
 
 func TestDeleteKeyPairFail(t *testing.T) {
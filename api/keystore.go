@@ -0,0 +1,80 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/arxanchain/safebox-sdk-go/keystore"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// ExportKeystore queries the key pair of info and returns it encrypted
+// under password, to be written with keystore.WriteFile. opts may be nil.
+// Private keys encrypted by the client, see WithKeyEncryption, are
+// exported decrypted.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) ExportKeystore(ctx context.Context, header http.Header, info *safebox.OperateKeyInfo, password []byte, opts *keystore.Options) (*keystore.Keystore, error) {
+	if info == nil {
+		return nil, newError(OpExportKeystore, ErrInvalidRequest, fmt.Errorf("request payload is null"))
+	}
+
+	secret, err := s.QueryPrivateKeySecret(ctx, header, info)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.Destroy()
+	reply, err := s.QueryPublicKeyWithContext(ctx, header, info)
+	if err != nil {
+		return nil, err
+	}
+
+	ks, err := keystore.Encrypt(info.UserDid, string(secret.Bytes()), reply.PublicKey, password, opts)
+	if err != nil {
+		return nil, newError(OpExportKeystore, ErrKeyEncryption, err)
+	}
+	return ks, nil
+}
+
+// ImportKeystore decrypts ks with password and trustees its key pair for
+// the DID it was exported from. It returns the reply of TrusteeKeyPair,
+// holding the new security code.
+//
+// A wrong password fails with ErrKeyEncryption, wrapping
+// keystore.ErrWrongPassword.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) ImportKeystore(ctx context.Context, header http.Header, ks *keystore.Keystore, password []byte) (*safebox.SaveKeyPairReply, error) {
+	if ks == nil {
+		return nil, newError(OpImportKeystore, ErrInvalidRequest, fmt.Errorf("keystore is null"))
+	}
+
+	privateKey, err := ks.Decrypt(password)
+	if err != nil {
+		return nil, newError(OpImportKeystore, ErrKeyEncryption, err)
+	}
+	defer wipe(privateKey)
+
+	return s.TrusteeKeyPairWithContext(ctx, header, &safebox.SaveKeyPairRequetBody{
+		UserDid:    ks.UserDid,
+		PrivateKey: string(privateKey),
+		PublicKey:  ks.PublicKey,
+	})
+}
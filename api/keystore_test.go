@@ -0,0 +1,81 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api_test
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"github.com/arxanchain/safebox-sdk-go/api/safeboxtest"
+	"github.com/arxanchain/safebox-sdk-go/keystore"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+func TestExportImportKeystore(t *testing.T) {
+	pair := &safebox.SaveKeyPairRequetBody{UserDid: "did:anx:00001", PrivateKey: "privatekey", PublicKey: "publickey"}
+	source := safeboxtest.NewServer()
+	defer source.Close()
+	source.Seed(pair, "code")
+	target := safeboxtest.NewServer()
+	defer target.Close()
+
+	sourceClient, err := source.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+	targetClient, err := target.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+
+	opts := &keystore.Options{ScryptN: 1024, Metadata: map[string]string{"env": "source"}}
+	ks, err := sourceClient.ExportKeystore(context.Background(), http.Header{}, &safebox.OperateKeyInfo{UserDid: pair.UserDid, Code: "code"}, []byte("password"), opts)
+	if err != nil {
+		t.Fatalf("export keystore error, %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	if err := keystore.WriteFile(path, ks); err != nil {
+		t.Fatalf("write keystore error, %v", err)
+	}
+	if ks, err = keystore.ReadFile(path); err != nil {
+		t.Fatalf("read keystore error, %v", err)
+	}
+
+	_, err = targetClient.ImportKeystore(context.Background(), http.Header{}, ks, []byte("wrong"))
+	if !stderrors.Is(err, api.ErrKeyEncryption) || !stderrors.Is(err, keystore.ErrWrongPassword) {
+		t.Fatalf("expected ErrKeyEncryption, got %v", err)
+	}
+	if n := target.Requests(safeboxtest.TrusteeURLPath); n != 0 {
+		t.Fatalf("nothing should be trusteed, got %d requests", n)
+	}
+
+	reply, err := targetClient.ImportKeystore(context.Background(), http.Header{}, ks, []byte("password"))
+	if err != nil {
+		t.Fatalf("import keystore error, %v", err)
+	}
+	body, code, ok := target.KeyPair(pair.UserDid)
+	if !ok || body.PrivateKey != pair.PrivateKey || body.PublicKey != pair.PublicKey {
+		t.Fatalf("key pair should be imported, got %+v", body)
+	}
+	if code != reply.Code {
+		t.Fatalf("security code should be %s, got %s", code, reply.Code)
+	}
+}
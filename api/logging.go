@@ -0,0 +1,215 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/arxanchain/sdk-go-common/structs/did"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// RedactedValue replaces secrets in logs.
+const RedactedValue = "[REDACTED]"
+
+// Redacted wraps a safebox request or reply so that it is logged or
+// printed with its private keys and security codes redacted. See Redact.
+type Redacted struct {
+	v interface{}
+}
+
+var (
+	_ slog.LogValuer = Redacted{}
+	_ fmt.Stringer   = Redacted{}
+)
+
+// Redact wraps v, a safebox request or reply or a pointer to one, so that
+// its PrivateKey, Code, OriginalCode and NewCode fields are redacted when it
+// is logged with log/slog or formatted with fmt:
+//
+//	logger.Info("trustee", "body", api.Redact(body))
+//
+// Values of other types are redacted as a whole.
+func Redact(v interface{}) Redacted {
+	return Redacted{v: v}
+}
+
+type redactedField struct {
+	name   string
+	value  string
+	secret bool
+}
+
+// fields returns the fields of r.v, and false if its type is unknown.
+func (r Redacted) fields() ([]redactedField, bool) {
+	switch v := r.v.(type) {
+	case *safebox.SaveKeyPairRequetBody:
+		if v == nil {
+			return nil, true
+		}
+		return Redact(*v).fields()
+	case safebox.SaveKeyPairRequetBody:
+		return []redactedField{
+			{"UserDid", v.UserDid, false},
+			{"PrivateKey", v.PrivateKey, true},
+			{"PublicKey", v.PublicKey, false},
+		}, true
+	case *safebox.OperateKeyInfo:
+		if v == nil {
+			return nil, true
+		}
+		return Redact(*v).fields()
+	case safebox.OperateKeyInfo:
+		return []redactedField{
+			{"UserDid", v.UserDid, false},
+			{"Code", v.Code, true},
+		}, true
+	case *safebox.UpdateSecurityCodeRequestBody:
+		if v == nil {
+			return nil, true
+		}
+		return Redact(*v).fields()
+	case safebox.UpdateSecurityCodeRequestBody:
+		return []redactedField{
+			{"UserDid", v.UserDid, false},
+			{"OriginalCode", v.OriginalCode, true},
+			{"NewCode", v.NewCode, true},
+		}, true
+	case *safebox.SaveKeyPairReply:
+		if v == nil {
+			return nil, true
+		}
+		return Redact(*v).fields()
+	case safebox.SaveKeyPairReply:
+		return []redactedField{{"Code", v.Code, true}}, true
+	case *safebox.PrivateKeyReply:
+		if v == nil {
+			return nil, true
+		}
+		return Redact(*v).fields()
+	case safebox.PrivateKeyReply:
+		return []redactedField{{"PrivateKey", v.PrivateKey, true}}, true
+	case *safebox.PublicKeyReply:
+		if v == nil {
+			return nil, true
+		}
+		return Redact(*v).fields()
+	case safebox.PublicKeyReply:
+		return []redactedField{{"PublicKey", v.PublicKey, false}}, true
+	case *safebox.CodeInfoReply:
+		if v == nil {
+			return nil, true
+		}
+		return Redact(*v).fields()
+	case safebox.CodeInfoReply:
+		return []redactedField{{"Code", v.Code, true}}, true
+	case did.Identifier:
+		return []redactedField{{"UserDid", string(v), false}}, true
+	case nil:
+		return nil, true
+	default:
+		return nil, false
+	}
+}
+
+func (f redactedField) String() string {
+	if f.secret && f.value != "" {
+		return RedactedValue
+	}
+	return f.value
+}
+
+// LogValue implements slog.LogValuer.
+func (r Redacted) LogValue() slog.Value {
+	fields, ok := r.fields()
+	if !ok {
+		return slog.StringValue(RedactedValue)
+	}
+	attrs := make([]slog.Attr, len(fields))
+	for i, f := range fields {
+		attrs[i] = slog.String(f.name, f.String())
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// String implements fmt.Stringer, formatting like the %+v verb.
+func (r Redacted) String() string {
+	fields, ok := r.fields()
+	if !ok {
+		return RedactedValue
+	}
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = f.name + ":" + f.String()
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// GoString implements fmt.GoStringer, so that the %#v verb does not print
+// the wrapped value either.
+func (r Redacted) GoString() string {
+	return r.String()
+}
+
+// WithLogger makes the client log its requests to logger: each request at
+// the debug level with its redacted input, each completed call at the
+// debug level with its redacted reply and each failed call at the warn
+// level, with its duration, attempts, http status and error.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return WithMiddleware(LoggingMiddleware(logger))
+}
+
+// LoggingMiddleware returns the Middleware logging requests to logger, see
+// WithLogger.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) error {
+			logger.DebugContext(ctx, "safebox request",
+				slog.String("op", call.Op),
+				slog.String("user_did", call.UserDid),
+				slog.String("method", call.Method),
+				slog.String("path", call.Path),
+				slog.Any("request", Redact(call.Request)),
+			)
+
+			err := next(ctx, call)
+
+			attrs := []slog.Attr{
+				slog.String("op", call.Op),
+				slog.String("user_did", call.UserDid),
+				slog.Int("http_status", call.HTTPStatus),
+				slog.Int("attempts", call.Attempts),
+				slog.Duration("elapsed", time.Since(call.Start)),
+			}
+			if err == nil {
+				attrs = append(attrs, slog.Any("reply", Redact(call.Reply)))
+				logger.LogAttrs(ctx, slog.LevelDebug, "safebox reply", attrs...)
+				return nil
+			}
+			if e, ok := err.(*Error); ok && e.ErrCode != 0 {
+				attrs = append(attrs, slog.Int("err_code", e.ErrCode))
+			}
+			attrs = append(attrs, slog.String("error", err.Error()))
+			logger.LogAttrs(ctx, slog.LevelWarn, "safebox request failed", attrs...)
+			return err
+		}
+	}
+}
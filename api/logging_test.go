@@ -0,0 +1,110 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/arxanchain/sdk-go-common/structs/did"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestRedact(t *testing.T) {
+	body := &safebox.SaveKeyPairRequetBody{UserDid: "did:1", PrivateKey: "privatekey", PublicKey: "publickey"}
+	update := safebox.UpdateSecurityCodeRequestBody{UserDid: "did:1", OriginalCode: "oldcode", NewCode: "newcode"}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	logger.Info("test", "body", Redact(body), "update", Redact(update), "other", Redact([]byte("secret")))
+	fmt.Fprintf(&buf, "%v %+v %#v %s", Redact(body), Redact(&update), Redact(body), Redact(&safebox.PrivateKeyReply{PrivateKey: "privatekey"}))
+
+	out := buf.String()
+	for _, secret := range []string{"privatekey", "oldcode", "newcode", "secret"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("output leaks %q: %s", secret, out)
+		}
+	}
+	for _, want := range []string{`"PublicKey":"publickey"`, `"UserDid":"did:1"`, "{UserDid:did:1 PrivateKey:[REDACTED] PublicKey:publickey}"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output should contain %s: %s", want, out)
+		}
+	}
+	if s := Redact(&safebox.OperateKeyInfo{UserDid: "did:1"}).String(); s != "{UserDid:did:1 Code:}" {
+		t.Fatalf("empty secrets should be shown empty, got %s", s)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	initTestSafeboxClient(t, WithLogger(logger))
+	defer gock.Off()
+
+	gock.New(safeboxURL).
+		Get(privateURLPath).
+		Reply(http.StatusForbidden)
+
+	info := &safebox.OperateKeyInfo{UserDid: "did:1", Code: "securitycode"}
+	if _, err := safeboxClient.QueryPrivateKey(http.Header{}, info); err == nil {
+		t.Fatalf("query private key should fail")
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "securitycode") {
+		t.Fatalf("log leaks the security code: %s", out)
+	}
+	for _, want := range []string{"level=DEBUG msg=\"safebox request\" op=QueryPrivateKey user_did=did:1", "request.Code=[REDACTED]", "level=WARN msg=\"safebox request failed\"", "http_status=403"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("log should contain %s: %s", want, out)
+		}
+	}
+}
+
+func TestWithLoggerReply(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	initTestSafeboxClient(t, WithLogger(logger))
+	defer gock.Off()
+
+	mockPayload(t, gock.New(safeboxURL).Get(privateURLPath), &safebox.PrivateKeyReply{PrivateKey: "privatekey"})
+	mockPayload(t, gock.New(safeboxURL).Get(recoverCodeURLPath), &safebox.CodeInfoReply{Code: "securitycode"})
+
+	if _, err := safeboxClient.QueryPrivateKey(http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:1", Code: "code"}); err != nil {
+		t.Fatalf("query private key error, %v", err)
+	}
+	if _, err := safeboxClient.RecoverAssistCode(http.Header{}, did.Identifier("did:1")); err != nil {
+		t.Fatalf("recover assist code error, %v", err)
+	}
+
+	out := buf.String()
+	for _, secret := range []string{"privatekey", "securitycode"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("log leaks %q: %s", secret, out)
+		}
+	}
+	for _, want := range []string{"msg=\"safebox reply\" op=QueryPrivateKey", "reply.PrivateKey=[REDACTED]", "reply.Code=[REDACTED]"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("log should contain %s: %s", want, out)
+		}
+	}
+}
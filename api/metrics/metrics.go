@@ -0,0 +1,173 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics provides a SafeboxClient middleware recording Prometheus
+// metrics for every safebox operation:
+//
+//	m := metrics.New(metrics.Options{})
+//	prometheus.MustRegister(m)
+//	client, err := api.NewSafeboxClient(config, api.WithMiddleware(m.Middleware()))
+//
+// The following metrics are exported, labelled by operation:
+//
+//	safebox_requests_total            requests sent
+//	safebox_request_errors_total      failed requests, by ErrCode and kind
+//	safebox_request_duration_seconds  request latency, retries included
+package metrics
+
+import (
+	"context"
+	stderrors "errors"
+	"strconv"
+	"time"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Operations are the operations for which metrics are initialized to zero,
+// so that alerts see them before their first request.
+var Operations = []string{
+	api.OpTrusteeKeyPair,
+	api.OpQueryPrivateKey,
+	api.OpQueryPublicKey,
+	api.OpDeleteKeyPair,
+	api.OpUpdateAssistCode,
+	api.OpRecoverAssistCode,
+}
+
+// kinds names the sentinel errors in the kind label.
+var kinds = []struct {
+	err  error
+	name string
+}{
+	{api.ErrInvalidRequest, "invalid_request"},
+	{api.ErrUserExists, "user_exists"},
+	{api.ErrWrongSecurityCode, "wrong_security_code"},
+	{api.ErrKeyNotFound, "key_not_found"},
+	{api.ErrUnauthorized, "unauthorized"},
+	{api.ErrTransport, "transport"},
+	{api.ErrMalformedPayload, "malformed_payload"},
+	{api.ErrIdempotencyKeyReused, "idempotency_key_reused"},
+	{api.ErrKeyEncryption, "key_encryption"},
+	{api.ErrKeyMismatch, "key_mismatch"},
+}
+
+// Options configures the metrics.
+type Options struct {
+	// Namespace prefixes the metric names, "safebox" if empty.
+	Namespace string
+	// ConstLabels are added to every metric.
+	ConstLabels prometheus.Labels
+	// Buckets are the latency histogram buckets, in seconds.
+	// prometheus.DefBuckets is used if nil.
+	Buckets []float64
+}
+
+// Metrics records the metrics of safebox operations. It is a
+// prometheus.Collector, to be registered in a prometheus.Registerer.
+type Metrics struct {
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+var _ prometheus.Collector = (*Metrics)(nil)
+
+// New returns the metrics configured by opts.
+func New(opts Options) *Metrics {
+	if opts.Namespace == "" {
+		opts.Namespace = "safebox"
+	}
+	if opts.Buckets == nil {
+		opts.Buckets = prometheus.DefBuckets
+	}
+
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "requests_total",
+			Help:        "Number of safebox requests, by operation.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"op"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "request_errors_total",
+			Help:        "Number of failed safebox requests, by operation, safebox ErrCode and error kind.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"op", "err_code", "kind"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        "request_duration_seconds",
+			Help:        "Latency of safebox requests, retries included, by operation.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.Buckets,
+		}, []string{"op"}),
+	}
+	for _, op := range Operations {
+		m.requests.WithLabelValues(op)
+		m.duration.WithLabelValues(op)
+	}
+	return m
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.errors.Describe(ch)
+	m.duration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.errors.Collect(ch)
+	m.duration.Collect(ch)
+}
+
+// Middleware returns the api.Middleware recording the metrics of every
+// request of a SafeboxClient.
+func (m *Metrics) Middleware() api.Middleware {
+	return func(next api.Handler) api.Handler {
+		return func(ctx context.Context, call *api.Call) error {
+			err := next(ctx, call)
+
+			m.requests.WithLabelValues(call.Op).Inc()
+			m.duration.WithLabelValues(call.Op).Observe(time.Since(call.Start).Seconds())
+			if err != nil {
+				code, kind := classify(err)
+				m.errors.WithLabelValues(call.Op, code, kind).Inc()
+			}
+			return err
+		}
+	}
+}
+
+// classify returns the ErrCode and kind labels of err.
+func classify(err error) (code, kind string) {
+	code, kind = "0", "other"
+	var e *api.Error
+	if stderrors.As(err, &e) {
+		code = strconv.Itoa(e.ErrCode)
+	}
+	for _, k := range kinds {
+		if stderrors.Is(err, k.err) {
+			kind = k.name
+			break
+		}
+	}
+	return code, kind
+}
@@ -0,0 +1,78 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"github.com/arxanchain/safebox-sdk-go/api/safeboxtest"
+	"github.com/arxanchain/sdk-go-common/errors"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	srv := safeboxtest.NewServer()
+	defer srv.Close()
+	srv.Seed(&safebox.SaveKeyPairRequetBody{UserDid: "did:1", PrivateKey: "privatekey", PublicKey: "publickey"}, "code")
+
+	m := New(Options{})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(m); err != nil {
+		t.Fatalf("register metrics error, %v", err)
+	}
+	client, err := srv.NewClient(api.WithMiddleware(m.Middleware()))
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+
+	header := http.Header{}
+	if _, err = client.QueryPublicKey(header, &safebox.OperateKeyInfo{UserDid: "did:1", Code: "code"}); err != nil {
+		t.Fatalf("query public key error, %v", err)
+	}
+	if _, err = client.QueryPrivateKey(header, &safebox.OperateKeyInfo{UserDid: "did:1", Code: "wrong"}); err == nil {
+		t.Fatalf("query private key with wrong code should fail")
+	}
+	if _, err = client.RecoverAssistCode(header, "did:2"); err == nil {
+		t.Fatalf("recover code of unknown DID should fail")
+	}
+
+	if n := testutil.ToFloat64(m.requests.WithLabelValues(api.OpQueryPublicKey)); n != 1 {
+		t.Fatalf("expected 1 public key request, got %v", n)
+	}
+	if n := testutil.ToFloat64(m.requests.WithLabelValues(api.OpTrusteeKeyPair)); n != 0 {
+		t.Fatalf("expected no trustee request, got %v", n)
+	}
+
+	expected := fmt.Sprintf(`
+# HELP safebox_request_errors_total Number of failed safebox requests, by operation, safebox ErrCode and error kind.
+# TYPE safebox_request_errors_total counter
+safebox_request_errors_total{err_code="%[1]d",kind="key_not_found",op="QueryPrivateKey"} 1
+safebox_request_errors_total{err_code="%[1]d",kind="key_not_found",op="RecoverAssistCode"} 1
+`, int(errors.UserInfoNotExit))
+	if err = testutil.GatherAndCompare(reg, strings.NewReader(expected), "safebox_request_errors_total"); err != nil {
+		t.Fatalf("unexpected error metrics: %v", err)
+	}
+	if n := testutil.CollectAndCount(m.duration); n != len(Operations) {
+		t.Fatalf("expected a latency histogram per operation, got %d", n)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Call describes a request of a SafeboxClient operation going through the
+// middleware chain.
+type Call struct {
+	// Op is the operation, e.g. OpQueryPrivateKey.
+	Op string
+	// UserDid is the DID the operation applies to.
+	UserDid string
+	// Request is the input of the operation, e.g. the
+	// *safebox.SaveKeyPairRequetBody of TrusteeKeyPair. It holds secrets
+	// in clear: wrap it with Redact before logging it.
+	Request interface{}
+	// Method and Path are the http method and path of the request.
+	Method string
+	Path   string
+	// RouteTag is the route tag of the client configuration.
+	RouteTag string
+	// Header is the header sent with the request. It is a copy of the
+	// header given to the operation, which middleware may modify before
+	// calling the next Handler.
+	Header http.Header
+	// Start is when the call entered the chain.
+	Start time.Time
+	// Attempts is the number of attempts made, and HTTPStatus the http
+	// status of the last reply, zero if none was received. Both are set
+	// once the next Handler returns.
+	Attempts   int
+	HTTPStatus int
+	// Reply is the decoded reply of the operation, e.g. the
+	// *safebox.PrivateKeyReply of QueryPrivateKey, set once the next
+	// Handler returns without error. It holds secrets in clear: wrap it
+	// with Redact before logging it.
+	Reply interface{}
+}
+
+// Handler sends a call to the safebox service and decodes its reply.
+type Handler func(ctx context.Context, call *Call) error
+
+// Middleware wraps a Handler to act around every request sent by a
+// SafeboxClient. The middleware must call next to send the request, and
+// return its error unless it has a reason to replace it.
+type Middleware func(next Handler) Handler
+
+// WithMiddleware adds mw to the middleware chain of the client. The first
+// middleware added is the outermost one. Middleware run once per call,
+// around the retries of the call if any.
+//
+// Only requests sent to the service go through the chain: replies served
+// by the client itself, such as cached public keys or replayed trustee
+// replies, do not.
+func WithMiddleware(mw ...Middleware) ClientOption {
+	return func(s *SafeboxClient) {
+		s.middleware = append(s.middleware, mw...)
+	}
+}
+
+// BeforeRequest returns a Middleware calling fn before each request is
+// sent, e.g. to set headers. The request is not sent if fn fails, and the
+// error is returned by the operation.
+func BeforeRequest(fn func(ctx context.Context, call *Call) error) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) error {
+			if err := fn(ctx, call); err != nil {
+				return err
+			}
+			return next(ctx, call)
+		}
+	}
+}
+
+// AfterResponse returns a Middleware calling fn once each call completes,
+// with its duration and error.
+func AfterResponse(fn func(ctx context.Context, call *Call, elapsed time.Duration, err error)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) error {
+			err := next(ctx, call)
+			fn(ctx, call, time.Since(call.Start), err)
+			return err
+		}
+	}
+}
+
+// invoke sends req through the middleware chain, and decodes the reply with
+// decode, which returns the decoded reply. Errors returned by middleware
+// are wrapped into an *Error.
+func (s *SafeboxClient) invoke(ctx context.Context, header http.Header, req *request, decode func(resp *http.Response) (interface{}, error)) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	call := &Call{
+		Op:       req.op,
+		UserDid:  req.userDid,
+		Request:  req.input,
+		Method:   req.method,
+		Path:     req.path,
+		RouteTag: s.routeTag,
+		Header:   cloneHeader(header),
+		Start:    time.Now(),
+	}
+
+	var h Handler = func(ctx context.Context, call *Call) error {
+		req.call = call
+		resp, err := s.do(ctx, call.Header, req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		reply, err := decode(resp)
+		if err != nil {
+			return err
+		}
+		call.Reply = reply
+		return nil
+	}
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		h = s.middleware[i](h)
+	}
+
+	err := h(ctx, call)
+	if _, ok := err.(*Error); err != nil && !ok {
+		err = newError(req.op, nil, err)
+	}
+	return err
+}
+
+// httpStatus returns the http status of an attempt that returned resp and
+// err, zero if no reply was received.
+func httpStatus(resp *http.Response, err error) int {
+	if resp != nil {
+		return resp.StatusCode
+	}
+	if e, ok := err.(*Error); ok {
+		return e.HTTPStatus
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	defer gock.Off()
+	// Only matches once the middleware set the header
+	mockPayload(t, gock.New(safeboxURL).
+		Get(publicURLPath).
+		MatchHeader("X-Request-Id", "req-1"), &safebox.PublicKeyReply{PublicKey: "publickey"})
+
+	var trace []string
+	var done *Call
+	around := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, call *Call) error {
+				trace = append(trace, name+" before")
+				err := next(ctx, call)
+				trace = append(trace, name+" after")
+				return err
+			}
+		}
+	}
+	initTestSafeboxClient(t, WithMiddleware(
+		around("outer"),
+		BeforeRequest(func(ctx context.Context, call *Call) error {
+			trace = append(trace, "pre")
+			call.Header.Set("X-Request-Id", "req-1")
+			return nil
+		}),
+		AfterResponse(func(ctx context.Context, call *Call, elapsed time.Duration, err error) {
+			trace = append(trace, "post")
+			done = call
+		}),
+		around("inner"),
+	))
+
+	header := http.Header{}
+	if _, err := safeboxClient.QueryPublicKey(header, &safebox.OperateKeyInfo{UserDid: "did:1"}); err != nil {
+		t.Fatalf("query public key error, %v", err)
+	}
+
+	want := []string{"outer before", "pre", "inner before", "inner after", "post", "outer after"}
+	if fmt.Sprint(trace) != fmt.Sprint(want) {
+		t.Fatalf("middleware should run as %v, got %v", want, trace)
+	}
+	if header.Get("X-Request-Id") != "" {
+		t.Fatalf("caller header should not be modified")
+	}
+	if done.Op != OpQueryPublicKey || done.UserDid != "did:1" || done.Method != "GET" {
+		t.Fatalf("unexpected call %+v", done)
+	}
+	if done.Attempts != 1 || done.HTTPStatus != http.StatusOK || done.Start.IsZero() {
+		t.Fatalf("call should record its attempts and status, got %+v", done)
+	}
+}
+
+func TestMiddlewareAbort(t *testing.T) {
+	denied := fmt.Errorf("denied")
+	initTestSafeboxClient(t, WithMiddleware(
+		BeforeRequest(func(ctx context.Context, call *Call) error {
+			return denied
+		}),
+	))
+	defer gock.Off()
+	gock.New(safeboxURL).
+		Post(deleteURLPath).
+		Reply(http.StatusOK)
+
+	err := safeboxClient.DeleteKeyPair(http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:1"})
+	var e *Error
+	if !stderrors.As(err, &e) || e.Op != OpDeleteKeyPair || !stderrors.Is(err, denied) {
+		t.Fatalf("middleware error should be wrapped into an *Error, got %v", err)
+	}
+	if !gock.IsPending() {
+		t.Fatalf("aborted request should not be sent")
+	}
+}
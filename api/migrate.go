@@ -0,0 +1,189 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// MigrateOptions configures Migrate.
+type MigrateOptions struct {
+	// Concurrency bounds the number of key pairs migrated at once, it
+	// defaults to DefaultBatchConcurrency.
+	Concurrency int
+	// DeleteSource deletes each key pair from the source once it is
+	// trusteed and verified at the destination.
+	DeleteSource bool
+	// Progress, if not nil, is called after each key pair completes. Calls
+	// are serialized.
+	Progress func(BatchProgress)
+}
+
+// MigrationStep is a step of the migration of a key pair.
+type MigrationStep string
+
+// Steps of the migration of a key pair, in order.
+const (
+	// MigrationRead queries the key pair from the source.
+	MigrationRead MigrationStep = "read"
+	// MigrationTrustee trustees the key pair at the destination.
+	MigrationTrustee MigrationStep = "trustee"
+	// MigrationVerify reads the public key back from the destination.
+	MigrationVerify MigrationStep = "verify"
+	// MigrationDeleteSource deletes the key pair from the source.
+	MigrationDeleteSource MigrationStep = "delete-source"
+)
+
+// MigrationResult is the result of the migration of one key pair.
+type MigrationResult struct {
+	UserDid string `json:"user_did"`
+	// Code is the security code of the key pair at the destination, empty
+	// if it is not trusteed there.
+	Code string `json:"code,omitempty"`
+	// SourceDeleted reports that the key pair was deleted from the source.
+	SourceDeleted bool `json:"source_deleted,omitempty"`
+	// FailedStep is the step that failed, empty on success, and Err its
+	// error.
+	FailedStep MigrationStep `json:"failed_step,omitempty"`
+	Err        error         `json:"-"`
+}
+
+// MarshalJSON encodes r, with Err as the "error" string.
+func (r MigrationResult) MarshalJSON() ([]byte, error) {
+	type result MigrationResult
+	out := struct {
+		result
+		Error string `json:"error,omitempty"`
+	}{result: result(r)}
+	if r.Err != nil {
+		out.Error = r.Err.Error()
+	}
+	return json.Marshal(&out)
+}
+
+// MigrationReport is the result of Migrate. It holds the security codes
+// of the key pairs at the destination: store it accordingly.
+type MigrationReport struct {
+	// Results are in the order of the migrated key pairs.
+	Results   []MigrationResult `json:"results"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+}
+
+// Migrate copies the key pairs of infos from src to dst, keeping at most
+// opts.Concurrency migrations in flight. srcHeader and dstHeader are the
+// headers of the requests to src and dst, API-Key must be set to them.
+// opts may be nil.
+//
+// Each key pair is queried from src with the security code of its info,
+// trusteed at dst under a new security code, and its public key read back
+// from dst and compared to the one of src. A key pair whose public key
+// does not match is deleted from dst again and reported with an
+// ErrKeyMismatch error. With opts.DeleteSource, verified key pairs are then
+// deleted from src.
+//
+// Failures are reported per key pair in the report, which also counts
+// them. The returned error is not nil if ctx is done before all the key
+// pairs were attempted; these then carry that error.
+func Migrate(ctx context.Context, src *SafeboxClient, srcHeader http.Header, dst *SafeboxClient, dstHeader http.Header, infos []*safebox.OperateKeyInfo, opts *MigrateOptions) (*MigrationReport, error) {
+	if opts == nil {
+		opts = &MigrateOptions{}
+	}
+	report := &MigrationReport{Results: make([]MigrationResult, len(infos))}
+	progress := newBatchProgress(len(infos), opts.Progress)
+
+	ran, err := runBatch(ctx, OpMigrate, len(infos), opts.Concurrency, func(ctx context.Context, i int) error {
+		res := &report.Results[i]
+		res.FailedStep, res.Err = migrateKeyPair(ctx, src, srcHeader, dst, dstHeader, infos[i], opts.DeleteSource, res)
+		progress.done(res.UserDid, res.Err)
+		return nil
+	})
+	for i := range report.Results {
+		res := &report.Results[i]
+		if !ran[i] {
+			res.FailedStep, res.Err = MigrationRead, err
+			if infos[i] != nil {
+				res.UserDid = infos[i].UserDid
+			}
+		}
+		if res.Err != nil {
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+	}
+	return report, err
+}
+
+// migrateKeyPair migrates the key pair of info, filling res, and returns
+// the step that failed and its error.
+func migrateKeyPair(ctx context.Context, src *SafeboxClient, srcHeader http.Header, dst *SafeboxClient, dstHeader http.Header, info *safebox.OperateKeyInfo, deleteSource bool, res *MigrationResult) (MigrationStep, error) {
+	if info == nil || info.UserDid == "" {
+		return MigrationRead, newError(OpMigrate, ErrInvalidRequest, fmt.Errorf("request information is empty"))
+	}
+	res.UserDid = info.UserDid
+
+	secret, err := src.QueryPrivateKeySecret(ctx, srcHeader, info)
+	if err != nil {
+		return MigrationRead, err
+	}
+	defer secret.Destroy()
+	public, err := src.QueryPublicKeyWithContext(ctx, srcHeader, info)
+	if err != nil {
+		return MigrationRead, err
+	}
+
+	// A retried migration gets the original reply back
+	body := &safebox.SaveKeyPairRequetBody{
+		UserDid:    info.UserDid,
+		PrivateKey: string(secret.Bytes()),
+		PublicKey:  public.PublicKey,
+	}
+	h := cloneHeader(dstHeader)
+	SetIdempotencyKey(h, batchIdempotencyKey(body))
+	reply, err := dst.TrusteeKeyPairWithContext(ctx, h, body)
+	body.PrivateKey = ""
+	if err != nil {
+		return MigrationTrustee, err
+	}
+	res.Code = reply.Code
+
+	trusteed := &safebox.OperateKeyInfo{UserDid: info.UserDid, Code: reply.Code}
+	stored, err := dst.QueryPublicKeyWithContext(ctx, dstHeader, trusteed)
+	if err != nil {
+		return MigrationVerify, err
+	}
+	if stored.PublicKey != public.PublicKey {
+		if delErr := dst.DeleteKeyPairWithContext(ctx, dstHeader, trusteed); delErr == nil {
+			res.Code = ""
+		}
+		return MigrationVerify, newError(OpMigrate, ErrKeyMismatch, fmt.Errorf("destination public key differs from source"))
+	}
+
+	if deleteSource {
+		if err := src.DeleteKeyPairWithContext(ctx, srcHeader, info); err != nil {
+			return MigrationDeleteSource, err
+		}
+		res.SourceDeleted = true
+	}
+	return "", nil
+}
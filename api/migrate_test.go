@@ -0,0 +1,119 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api_test
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"testing"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"github.com/arxanchain/safebox-sdk-go/api/safeboxtest"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// newMigration returns a source seeded with the key pairs of dids, under
+// the security code "code", and an empty destination.
+func newMigration(t *testing.T, dids ...string) (src, dst *safeboxtest.Server, srcClient, dstClient *api.SafeboxClient) {
+	src, dst = safeboxtest.NewServer(), safeboxtest.NewServer()
+	for _, did := range dids {
+		src.Seed(&safebox.SaveKeyPairRequetBody{UserDid: did, PrivateKey: "private-" + did, PublicKey: "public-" + did}, "code")
+	}
+	var err error
+	if srcClient, err = src.NewClient(); err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+	if dstClient, err = dst.NewClient(); err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+	return
+}
+
+func TestMigrate(t *testing.T) {
+	src, dst, srcClient, dstClient := newMigration(t, "did:1", "did:2", "did:3")
+	defer src.Close()
+	defer dst.Close()
+	dst.Seed(&safebox.SaveKeyPairRequetBody{UserDid: "did:3", PrivateKey: "other", PublicKey: "other"}, "code")
+
+	infos := []*safebox.OperateKeyInfo{
+		{UserDid: "did:1", Code: "code"},
+		{UserDid: "did:2", Code: "wrong"},
+		{UserDid: "did:3", Code: "code"},
+	}
+	report, err := api.Migrate(context.Background(), srcClient, http.Header{}, dstClient, http.Header{}, infos, &api.MigrateOptions{DeleteSource: true})
+	if err != nil {
+		t.Fatalf("migrate error, %v", err)
+	}
+	if report.Succeeded != 1 || report.Failed != 2 {
+		t.Fatalf("expected 1 success and 2 failures, got %+v", report)
+	}
+
+	ok := report.Results[0]
+	body, code, found := dst.KeyPair("did:1")
+	if ok.Err != nil || !found || body.PrivateKey != "private-did:1" || code != ok.Code || !ok.SourceDeleted {
+		t.Fatalf("did:1 should be migrated, got %+v", ok)
+	}
+	if _, _, found := src.KeyPair("did:1"); found {
+		t.Fatalf("did:1 should be deleted from the source")
+	}
+
+	for i, want := range []struct {
+		step api.MigrationStep
+		kind error
+	}{
+		{api.MigrationRead, api.ErrKeyNotFound},
+		{api.MigrationTrustee, api.ErrUserExists},
+	} {
+		res := report.Results[i+1]
+		if res.FailedStep != want.step || !stderrors.Is(res.Err, want.kind) || res.SourceDeleted {
+			t.Fatalf("%s: expected %s failure with %v, got %+v", res.UserDid, want.step, want.kind, res)
+		}
+		if _, _, found := src.KeyPair(res.UserDid); !found {
+			t.Fatalf("%s should be kept at the source", res.UserDid)
+		}
+	}
+}
+
+func TestMigrateMismatch(t *testing.T) {
+	src, dst, srcClient, dstClient := newMigration(t, "did:1")
+	defer src.Close()
+	defer dst.Close()
+	dst.AddHook(func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != safeboxtest.PublicURLPath {
+			return false
+		}
+		safeboxtest.WritePayload(w, &safebox.PublicKeyReply{PublicKey: "altered"})
+		return true
+	})
+
+	infos := []*safebox.OperateKeyInfo{{UserDid: "did:1", Code: "code"}}
+	report, err := api.Migrate(context.Background(), srcClient, http.Header{}, dstClient, http.Header{}, infos, &api.MigrateOptions{DeleteSource: true})
+	if err != nil {
+		t.Fatalf("migrate error, %v", err)
+	}
+	res := report.Results[0]
+	if res.FailedStep != api.MigrationVerify || !stderrors.Is(res.Err, api.ErrKeyMismatch) || res.Code != "" {
+		t.Fatalf("expected verify failure, got %+v", res)
+	}
+	if _, _, found := dst.KeyPair("did:1"); found {
+		t.Fatalf("mismatched key pair should be deleted from the destination")
+	}
+	if _, _, found := src.KeyPair("did:1"); !found {
+		t.Fatalf("key pair should be kept at the source")
+	}
+}
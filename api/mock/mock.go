@@ -0,0 +1,392 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mock provides a programmable fake of api.SafeboxAPI.
+//
+// It lets code written against the safebox client be unit tested without
+// any http traffic:
+//
+//	m := mock.New()
+//	m.On(mock.MethodTrusteeKeyPair).Return(&safebox.SaveKeyPairReply{Code: "code"}, nil).Once()
+//	m.On(mock.MethodQueryPublicKey).ReturnError(errors.New("boom"))
+//
+//	svc := NewService(m) // accepts an api.SafeboxAPI
+//	...
+//	m.AssertExpectations(t)
+package mock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"github.com/arxanchain/sdk-go-common/structs/did"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// Method names accepted by SafeboxClient.On. The WithContext variant of a
+// method shares its name.
+const (
+	MethodTrusteeKeyPair    = "TrusteeKeyPair"
+	MethodQueryPrivateKey   = "QueryPrivateKey"
+	MethodQueryPublicKey    = "QueryPublicKey"
+	MethodDeleteKeyPair     = "DeleteKeyPair"
+	MethodUpdateAssistCode  = "UpdateAssistCode"
+	MethodRecoverAssistCode = "RecoverAssistCode"
+)
+
+// ErrUnexpectedCall is returned by every method that is called without a
+// matching expectation.
+var ErrUnexpectedCall = fmt.Errorf("mock: unexpected call")
+
+// TestingT is the subset of testing.T used by AssertExpectations.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Call records a single invocation made against the mock.
+type Call struct {
+	Method string
+	// Ctx is the context passed to the WithContext variant, or
+	// context.Background for the other methods.
+	Ctx    context.Context
+	Header http.Header
+	// Arg is the request argument, e.g. *safebox.OperateKeyInfo for
+	// QueryPublicKey or did.Identifier for RecoverAssistCode.
+	Arg interface{}
+}
+
+// Expectation describes how the mock answers calls to one method.
+//
+// Expectations must be fully configured before the mock is used.
+type Expectation struct {
+	m       *SafeboxClient
+	method  string
+	matcher func(header http.Header, arg interface{}) bool
+	result  interface{}
+	err     error
+	times   int
+	calls   int
+}
+
+// Match restricts the expectation to calls for which fn returns true.
+func (e *Expectation) Match(fn func(header http.Header, arg interface{}) bool) *Expectation {
+	e.matcher = fn
+	return e
+}
+
+// Return sets the result and error returned by matching calls. result must
+// have the return type of the expected method, e.g. *safebox.PublicKeyReply
+// for QueryPublicKey and *api.Confirmation for DeleteKeyPair and
+// UpdateAssistCode, whose Confirmed variants return an empty confirmation
+// when both result and err are nil; the other methods fail, as the real
+// client never returns a nil result without an error.
+func (e *Expectation) Return(result interface{}, err error) *Expectation {
+	e.result = result
+	e.err = err
+	return e
+}
+
+// ReturnError makes matching calls fail with err.
+func (e *Expectation) ReturnError(err error) *Expectation {
+	return e.Return(nil, err)
+}
+
+// Times limits the expectation to n calls. Once it is used up, further
+// calls fall through to the next matching expectation. Zero means
+// unlimited, which is the default.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Once is shorthand for Times(1).
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+// consume counts a call to e, unless e is used up.
+func (e *Expectation) consume() bool {
+	e.m.mu.Lock()
+	defer e.m.mu.Unlock()
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+	e.calls++
+	return true
+}
+
+// SafeboxClient is a programmable fake implementing api.SafeboxAPI.
+//
+// It is safe for concurrent use.
+type SafeboxClient struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []Call
+}
+
+var _ api.SafeboxAPI = (*SafeboxClient)(nil)
+
+// New returns a SafeboxClient without any expectation.
+func New() *SafeboxClient {
+	return &SafeboxClient{}
+}
+
+// On registers a new expectation for method. Expectations are matched in
+// registration order.
+func (m *SafeboxClient) On(method string) *Expectation {
+	e := &Expectation{m: m, method: method}
+	m.mu.Lock()
+	m.expectations = append(m.expectations, e)
+	m.mu.Unlock()
+	return e
+}
+
+// Calls returns every call made so far, in order.
+func (m *SafeboxClient) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	calls := make([]Call, len(m.calls))
+	copy(calls, m.calls)
+	return calls
+}
+
+// CallsTo returns the calls made so far to method, in order.
+func (m *SafeboxClient) CallsTo(method string) []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var calls []Call
+	for _, c := range m.calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset drops all expectations and recorded calls.
+func (m *SafeboxClient) Reset() {
+	m.mu.Lock()
+	m.expectations = nil
+	m.calls = nil
+	m.mu.Unlock()
+}
+
+// AssertExpectations reports through t every expectation registered with
+// Times that has not been called the expected number of times, and every
+// unlimited expectation that was never called.
+func (m *SafeboxClient) AssertExpectations(t TestingT) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ok := true
+	for _, e := range m.expectations {
+		switch {
+		case e.times > 0 && e.calls != e.times:
+			t.Errorf("mock: %s expected %d call(s), got %d", e.method, e.times, e.calls)
+			ok = false
+		case e.times == 0 && e.calls == 0:
+			t.Errorf("mock: %s expected to be called", e.method)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// call records the invocation and returns the programmed answer.
+//
+// A call made with a done context is recorded but fails with ctx.Err()
+// without consuming any expectation. Matchers run without the lock held,
+// so they may call the mock, e.g. Calls.
+func (m *SafeboxClient) call(ctx context.Context, method string, header http.Header, arg interface{}) (interface{}, error) {
+	m.mu.Lock()
+	m.calls = append(m.calls, Call{Method: method, Ctx: ctx, Header: cloneHeader(header), Arg: arg})
+	expectations := make([]*Expectation, len(m.expectations))
+	copy(expectations, m.expectations)
+	m.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, e := range expectations {
+		if e.method != method || (e.matcher != nil && !e.matcher(header, arg)) {
+			continue
+		}
+		if e.consume() {
+			return e.result, e.err
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnexpectedCall, method)
+}
+
+func cloneHeader(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+func resultTypeError(method string, result interface{}) error {
+	return fmt.Errorf("mock: %s result has invalid type %T", method, result)
+}
+
+// nilResultError is returned for a nil result without an error, which the
+// real client never returns.
+func nilResultError(method string) error {
+	return fmt.Errorf("mock: %s returned neither a result nor an error", method)
+}
+
+// TrusteeKeyPair implements api.SafeboxAPI.
+func (m *SafeboxClient) TrusteeKeyPair(header http.Header, body *safebox.SaveKeyPairRequetBody) (*safebox.SaveKeyPairReply, error) {
+	return m.TrusteeKeyPairWithContext(context.Background(), header, body)
+}
+
+// TrusteeKeyPairWithContext implements api.SafeboxAPI.
+func (m *SafeboxClient) TrusteeKeyPairWithContext(ctx context.Context, header http.Header, body *safebox.SaveKeyPairRequetBody) (*safebox.SaveKeyPairReply, error) {
+	res, err := m.call(ctx, MethodTrusteeKeyPair, header, body)
+	if res == nil {
+		if err == nil {
+			err = nilResultError(MethodTrusteeKeyPair)
+		}
+		return nil, err
+	}
+	result, ok := res.(*safebox.SaveKeyPairReply)
+	if !ok {
+		return nil, resultTypeError(MethodTrusteeKeyPair, res)
+	}
+	return result, err
+}
+
+// QueryPrivateKey implements api.SafeboxAPI.
+func (m *SafeboxClient) QueryPrivateKey(header http.Header, info *safebox.OperateKeyInfo) (*safebox.PrivateKeyReply, error) {
+	return m.QueryPrivateKeyWithContext(context.Background(), header, info)
+}
+
+// QueryPrivateKeyWithContext implements api.SafeboxAPI.
+func (m *SafeboxClient) QueryPrivateKeyWithContext(ctx context.Context, header http.Header, info *safebox.OperateKeyInfo) (*safebox.PrivateKeyReply, error) {
+	res, err := m.call(ctx, MethodQueryPrivateKey, header, info)
+	if res == nil {
+		if err == nil {
+			err = nilResultError(MethodQueryPrivateKey)
+		}
+		return nil, err
+	}
+	result, ok := res.(*safebox.PrivateKeyReply)
+	if !ok {
+		return nil, resultTypeError(MethodQueryPrivateKey, res)
+	}
+	return result, err
+}
+
+// QueryPublicKey implements api.SafeboxAPI.
+func (m *SafeboxClient) QueryPublicKey(header http.Header, info *safebox.OperateKeyInfo) (*safebox.PublicKeyReply, error) {
+	return m.QueryPublicKeyWithContext(context.Background(), header, info)
+}
+
+// QueryPublicKeyWithContext implements api.SafeboxAPI.
+func (m *SafeboxClient) QueryPublicKeyWithContext(ctx context.Context, header http.Header, info *safebox.OperateKeyInfo) (*safebox.PublicKeyReply, error) {
+	res, err := m.call(ctx, MethodQueryPublicKey, header, info)
+	if res == nil {
+		if err == nil {
+			err = nilResultError(MethodQueryPublicKey)
+		}
+		return nil, err
+	}
+	result, ok := res.(*safebox.PublicKeyReply)
+	if !ok {
+		return nil, resultTypeError(MethodQueryPublicKey, res)
+	}
+	return result, err
+}
+
+// DeleteKeyPair implements api.SafeboxAPI.
+func (m *SafeboxClient) DeleteKeyPair(header http.Header, body *safebox.OperateKeyInfo) error {
+	return m.DeleteKeyPairWithContext(context.Background(), header, body)
+}
+
+// DeleteKeyPairWithContext implements api.SafeboxAPI.
+func (m *SafeboxClient) DeleteKeyPairWithContext(ctx context.Context, header http.Header, body *safebox.OperateKeyInfo) error {
+	_, err := m.DeleteKeyPairConfirmed(ctx, header, body)
+	return err
+}
+
+// DeleteKeyPairConfirmed implements api.SafeboxAPI.
+func (m *SafeboxClient) DeleteKeyPairConfirmed(ctx context.Context, header http.Header, body *safebox.OperateKeyInfo) (*api.Confirmation, error) {
+	res, err := m.call(ctx, MethodDeleteKeyPair, header, body)
+	if res == nil {
+		if err == nil {
+			return &api.Confirmation{}, nil
+		}
+		return nil, err
+	}
+	result, ok := res.(*api.Confirmation)
+	if !ok {
+		return nil, resultTypeError(MethodDeleteKeyPair, res)
+	}
+	return result, err
+}
+
+// UpdateAssistCode implements api.SafeboxAPI.
+func (m *SafeboxClient) UpdateAssistCode(header http.Header, body *safebox.UpdateSecurityCodeRequestBody) error {
+	return m.UpdateAssistCodeWithContext(context.Background(), header, body)
+}
+
+// UpdateAssistCodeWithContext implements api.SafeboxAPI.
+func (m *SafeboxClient) UpdateAssistCodeWithContext(ctx context.Context, header http.Header, body *safebox.UpdateSecurityCodeRequestBody) error {
+	_, err := m.UpdateAssistCodeConfirmed(ctx, header, body)
+	return err
+}
+
+// UpdateAssistCodeConfirmed implements api.SafeboxAPI.
+func (m *SafeboxClient) UpdateAssistCodeConfirmed(ctx context.Context, header http.Header, body *safebox.UpdateSecurityCodeRequestBody) (*api.Confirmation, error) {
+	res, err := m.call(ctx, MethodUpdateAssistCode, header, body)
+	if res == nil {
+		if err == nil {
+			return &api.Confirmation{}, nil
+		}
+		return nil, err
+	}
+	result, ok := res.(*api.Confirmation)
+	if !ok {
+		return nil, resultTypeError(MethodUpdateAssistCode, res)
+	}
+	return result, err
+}
+
+// RecoverAssistCode implements api.SafeboxAPI.
+func (m *SafeboxClient) RecoverAssistCode(header http.Header, id did.Identifier) (*safebox.CodeInfoReply, error) {
+	return m.RecoverAssistCodeWithContext(context.Background(), header, id)
+}
+
+// RecoverAssistCodeWithContext implements api.SafeboxAPI.
+func (m *SafeboxClient) RecoverAssistCodeWithContext(ctx context.Context, header http.Header, id did.Identifier) (*safebox.CodeInfoReply, error) {
+	res, err := m.call(ctx, MethodRecoverAssistCode, header, id)
+	if res == nil {
+		if err == nil {
+			err = nilResultError(MethodRecoverAssistCode)
+		}
+		return nil, err
+	}
+	result, ok := res.(*safebox.CodeInfoReply)
+	if !ok {
+		return nil, resultTypeError(MethodRecoverAssistCode, res)
+	}
+	return result, err
+}
@@ -0,0 +1,150 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/arxanchain/sdk-go-common/structs"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+type recorder struct {
+	errs []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func TestTrusteeKeyPairReturn(t *testing.T) {
+	m := New()
+	m.On(MethodTrusteeKeyPair).Return(&safebox.SaveKeyPairReply{Code: "我是中国人"}, nil).Once()
+
+	header := http.Header{}
+	header.Set(structs.APIKeyHeader, "1234567890")
+	req := &safebox.SaveKeyPairRequetBody{UserDid: "did:anx:00001"}
+
+	resp, err := m.TrusteeKeyPair(header, req)
+	if err != nil {
+		t.Fatalf("trustee key pair error, %v", err)
+	}
+	if resp == nil || resp.Code != "我是中国人" {
+		t.Fatalf("trustee key pair return code error")
+	}
+
+	calls := m.CallsTo(MethodTrusteeKeyPair)
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 recorded call, got %d", len(calls))
+	}
+	if calls[0].Arg != req || calls[0].Header.Get(structs.APIKeyHeader) != "1234567890" {
+		t.Fatalf("recorded call mismatch: %+v", calls[0])
+	}
+	m.AssertExpectations(t)
+
+	// the only expectation is used up
+	_, err = m.TrusteeKeyPair(header, req)
+	if !errors.Is(err, ErrUnexpectedCall) {
+		t.Fatalf("expected unexpected call error, got %v", err)
+	}
+}
+
+func TestQueryPublicKeyMatch(t *testing.T) {
+	m := New()
+	m.On(MethodQueryPublicKey).
+		Match(func(header http.Header, arg interface{}) bool {
+			return arg.(*safebox.OperateKeyInfo).UserDid == "did:anx:00001"
+		}).
+		Return(&safebox.PublicKeyReply{PublicKey: "publickey"}, nil)
+	m.On(MethodQueryPublicKey).ReturnError(fmt.Errorf("user does not exist"))
+
+	resp, err := m.QueryPublicKey(nil, &safebox.OperateKeyInfo{UserDid: "did:anx:00001"})
+	if err != nil || resp.PublicKey != "publickey" {
+		t.Fatalf("query public key error, %v", err)
+	}
+	resp, err = m.QueryPublicKey(nil, &safebox.OperateKeyInfo{UserDid: "did:anx:00002"})
+	if err == nil || resp != nil {
+		t.Fatalf("query public key should fail")
+	}
+}
+
+func TestResultTypeInvalid(t *testing.T) {
+	m := New()
+	m.On(MethodQueryPrivateKey).Return(&safebox.PublicKeyReply{}, nil)
+
+	resp, err := m.QueryPrivateKey(nil, &safebox.OperateKeyInfo{})
+	if err == nil || resp != nil {
+		t.Fatalf("query private key should fail on invalid result type")
+	}
+}
+
+func TestAssertExpectations(t *testing.T) {
+	m := New()
+	m.On(MethodDeleteKeyPair).Times(2)
+	m.On(MethodRecoverAssistCode)
+
+	if err := m.DeleteKeyPair(nil, &safebox.OperateKeyInfo{}); err != nil {
+		t.Fatalf("delete key pair error, %v", err)
+	}
+
+	r := &recorder{}
+	if m.AssertExpectations(r) {
+		t.Fatalf("expectations should not be met")
+	}
+	if len(r.errs) != 2 {
+		t.Fatalf("expected 2 failures, got %v", r.errs)
+	}
+
+	m.Reset()
+	if len(m.Calls()) != 0 || !m.AssertExpectations(t) {
+		t.Fatalf("reset should drop calls and expectations")
+	}
+}
+
+func TestMatcherCallsMock(t *testing.T) {
+	m := New()
+	m.On(MethodQueryPublicKey).
+		Match(func(header http.Header, arg interface{}) bool {
+			return len(m.CallsTo(MethodQueryPublicKey)) > 1
+		}).
+		Return(&safebox.PublicKeyReply{PublicKey: "publickey"}, nil)
+	m.On(MethodQueryPublicKey).ReturnError(fmt.Errorf("first call"))
+
+	if _, err := m.QueryPublicKey(nil, &safebox.OperateKeyInfo{}); err == nil {
+		t.Fatalf("first query public key should fail")
+	}
+	if resp, err := m.QueryPublicKey(nil, &safebox.OperateKeyInfo{}); err != nil || resp.PublicKey != "publickey" {
+		t.Fatalf("query public key error, %v", err)
+	}
+}
+
+func TestNilResult(t *testing.T) {
+	m := New()
+	m.On(MethodQueryPublicKey)
+	m.On(MethodDeleteKeyPair)
+
+	resp, err := m.QueryPublicKey(nil, &safebox.OperateKeyInfo{})
+	if err == nil || resp != nil {
+		t.Fatalf("query public key should fail on nil result")
+	}
+	if err = m.DeleteKeyPair(nil, &safebox.OperateKeyInfo{}); err != nil {
+		t.Fatalf("delete key pair error, %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/arxanchain/sdk-go-common/errors"
+	restapi "github.com/arxanchain/sdk-go-common/rest/api"
+	reststruct "github.com/arxanchain/sdk-go-common/rest/structs"
+)
+
+// request describes a call to the safebox service. A new restapi.Request is
+// built from it for every attempt, as a request body can only be sent once.
+type request struct {
+	op      string
+	userDid string
+	method  string
+	path    string
+	params  map[string]string
+	body    interface{}
+	// input is the input of the operation, reported in Call.Request.
+	input interface{}
+	// safe is true for operations without side effects, which may always be
+	// retried.
+	safe bool
+	// call, if not nil, records the attempts made.
+	call *Call
+}
+
+// build returns the restapi.Request for req with header set.
+func (s *SafeboxClient) build(req *request, header http.Header) *restapi.Request {
+	r := s.c.NewRequest(req.method, req.path)
+	r.SetHeaders(header)
+	for k, v := range req.params {
+		r.SetParam(k, v)
+	}
+	if req.body != nil {
+		r.SetBody(req.body)
+	}
+	return r
+}
+
+// do sends req with header bound to ctx and returns the response if its
+// status is OK. Any other status is returned as an *Error built from the
+// reply envelope. Once ctx is done, the request is aborted and an
+// ErrTransport error wrapping ctx.Err() is returned.
+//
+// Failed attempts are retried according to the retry policy of the client
+// when req is safe, or when header carries an idempotency key.
+func (s *SafeboxClient) do(ctx context.Context, header http.Header, req *request) (*http.Response, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	attempts := 1
+	if s.retry != nil && (req.safe || header.Get(IdempotencyKeyHeader) != "") {
+		attempts = s.retry.MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := s.send(ctx, header, req)
+		if req.call != nil {
+			req.call.Attempts = attempt
+			req.call.HTTPStatus = httpStatus(resp, err)
+		}
+		if err == nil || attempt >= attempts || !s.retry.retryable(err) {
+			return resp, err
+		}
+
+		timer := time.NewTimer(s.retry.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, newError(req.op, ErrTransport, ctx.Err())
+		}
+	}
+}
+
+// send makes a single attempt of req.
+func (s *SafeboxClient) send(ctx context.Context, header http.Header, req *request) (*http.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, newError(req.op, ErrTransport, err)
+	}
+
+	h := make(http.Header, len(header)+1)
+	for k, v := range header {
+		h[k] = v
+	}
+	if ctx != context.Background() {
+		id := s.transport.register(ctx)
+		defer s.transport.unregister(id)
+		h.Set(contextHeader, id)
+	}
+
+	_, resp, err := s.c.DoRequest(s.build(req, h))
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		return nil, newError(req.op, ErrTransport, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		// The body of a failed request is not always an envelope
+		var respBody reststruct.Response
+		if err = restapi.DecodeBody(resp, &respBody); err != nil {
+			respBody.ErrMessage = http.StatusText(resp.StatusCode)
+		}
+		return nil, newServiceError(req.op, resp.StatusCode, int(respBody.ErrCode), respBody.ErrMessage)
+	}
+	return resp, nil
+}
+
+// decodeEnvelope decodes the reply envelope of resp. A non-zero ErrCode is
+// returned as an *Error.
+func decodeEnvelope(op string, resp *http.Response) (*reststruct.Response, error) {
+	var respBody reststruct.Response
+	if err := restapi.DecodeBody(resp, &respBody); err != nil {
+		return nil, malformedPayload(op, resp, err)
+	}
+
+	if respBody.ErrCode != errors.SuccCode {
+		return nil, newServiceError(op, resp.StatusCode, int(respBody.ErrCode), respBody.ErrMessage)
+	}
+	return &respBody, nil
+}
+
+// decodePayload decodes the reply envelope of resp and unmarshals its string
+// encoded payload into result.
+func decodePayload(op string, resp *http.Response, result interface{}) error {
+	respBody, err := decodeEnvelope(op, resp)
+	if err != nil {
+		return err
+	}
+
+	payload, ok := respBody.Payload.(string)
+	if !ok {
+		err = fmt.Errorf("response payload type invalid: %v", reflect.TypeOf(respBody.Payload))
+		return malformedPayload(op, resp, err)
+	}
+
+	if err = json.Unmarshal([]byte(payload), result); err != nil {
+		return malformedPayload(op, resp, err)
+	}
+	return nil
+}
+
+// decodeConfirmation decodes the reply envelope of resp for operations
+// whose payload is optional.
+func decodeConfirmation(op string, resp *http.Response) (*Confirmation, error) {
+	respBody, err := decodeEnvelope(op, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	switch payload := respBody.Payload.(type) {
+	case nil:
+		return &Confirmation{}, nil
+	case string:
+		return &Confirmation{Payload: payload}, nil
+	default:
+		err = fmt.Errorf("response payload type invalid: %v", reflect.TypeOf(respBody.Payload))
+		return nil, malformedPayload(op, resp, err)
+	}
+}
+
+func malformedPayload(op string, resp *http.Response, err error) *Error {
+	e := newError(op, ErrMalformedPayload, err)
+	e.HTTPStatus = resp.StatusCode
+	return e
+}
@@ -0,0 +1,117 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	stderrors "errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried.
+//
+// Safe reads (QueryPublicKey, QueryPrivateKey and RecoverAssistCode) are
+// retried automatically. Writes are only retried when the request carries
+// an idempotency key in IdempotencyKeyHeader, so that the service can tell
+// a replay from a new request.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// one. Values below 2 disable retrying.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor applied to the delay after each retry.
+	// Values below 1 are treated as 1.
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, of each delay that is
+	// randomized to spread retries of concurrent callers.
+	Jitter float64
+	// Retryable reports whether a failed attempt should be retried.
+	// DefaultRetryable is used if nil.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy returns a policy making up to 3 attempts with an
+// exponential backoff starting at 100ms.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// WithRetryPolicy makes the client retry failed requests according to p.
+func WithRetryPolicy(p RetryPolicy) ClientOption {
+	return func(s *SafeboxClient) {
+		s.retry = &p
+	}
+}
+
+// DefaultRetryable reports whether err is a transient failure: the service
+// could not be reached or the connection was reset, or the gateway answered
+// with 429, 502, 503 or 504. Failures caused by a done context are never
+// retried.
+func DefaultRetryable(err error) bool {
+	if stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var e *Error
+	if !stderrors.As(err, &e) {
+		return false
+	}
+	switch e.HTTPStatus {
+	case 0:
+		return stderrors.Is(err, ErrTransport)
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return DefaultRetryable(err)
+}
+
+// backoff returns the delay to wait after the given failed attempt,
+// starting at 1.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		d -= d * jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,174 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+	Multiplier:     2,
+	Jitter:         0.5,
+}
+
+func TestRetrySafeRead(t *testing.T) {
+	initTestSafeboxClient(t, WithRetryPolicy(testRetryPolicy))
+	defer gock.Off()
+
+	gock.New(safeboxURL).
+		Get(publicURLPath).
+		Times(2).
+		Reply(http.StatusServiceUnavailable)
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath), &safebox.PublicKeyReply{PublicKey: "publickey"})
+
+	resp, err := safeboxClient.QueryPublicKey(http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:anx:00001"})
+	if err != nil {
+		t.Fatalf("get public error, %v", err)
+	}
+	if resp.PublicKey != "publickey" {
+		t.Fatalf("get public return key error")
+	}
+	if !gock.IsDone() {
+		t.Fatalf("expected 3 attempts")
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	initTestSafeboxClient(t, WithRetryPolicy(testRetryPolicy))
+	defer gock.Off()
+
+	gock.New(safeboxURL).
+		Get(recoverCodeURLPath).
+		Times(3).
+		Reply(http.StatusBadGateway)
+
+	_, err := safeboxClient.RecoverAssistCode(http.Header{}, "did:anx:00001")
+	var e *Error
+	if !errors.As(err, &e) || e.HTTPStatus != http.StatusBadGateway {
+		t.Fatalf("expected bad gateway error, got %v", err)
+	}
+	if !gock.IsDone() {
+		t.Fatalf("expected 3 attempts")
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	initTestSafeboxClient(t, WithRetryPolicy(testRetryPolicy))
+	defer gock.Off()
+
+	gock.New(safeboxURL).
+		Get(privateURLPath).
+		Reply(http.StatusBadRequest)
+	mockPayload(t, gock.New(safeboxURL).Get(privateURLPath), &safebox.PrivateKeyReply{})
+
+	_, err := safeboxClient.QueryPrivateKey(http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:anx:00001"})
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected invalid request error, got %v", err)
+	}
+	if len(gock.Pending()) != 1 {
+		t.Fatalf("expected 1 attempt")
+	}
+}
+
+func TestRetryWriteNeedsIdempotencyKey(t *testing.T) {
+	initTestSafeboxClient(t, WithRetryPolicy(testRetryPolicy))
+	defer gock.Off()
+	body := &safebox.SaveKeyPairRequetBody{UserDid: "did:anx:00001"}
+
+	gock.New(safeboxURL).
+		Post(trusteeURLPath).
+		Reply(http.StatusServiceUnavailable)
+	mockPayload(t, gock.New(safeboxURL).Post(trusteeURLPath), &safebox.SaveKeyPairReply{Code: "code"})
+	if _, err := safeboxClient.TrusteeKeyPair(http.Header{}, body); err == nil {
+		t.Fatalf("trustee key pair without idempotency key should not be retried")
+	}
+	if len(gock.Pending()) != 1 {
+		t.Fatalf("expected 1 attempt")
+	}
+
+	gock.Flush()
+	gock.New(safeboxURL).
+		Post(trusteeURLPath).
+		Reply(http.StatusServiceUnavailable)
+	mockPayload(t, gock.New(safeboxURL).Post(trusteeURLPath), &safebox.SaveKeyPairReply{Code: "code"})
+	header := http.Header{}
+	header.Set(IdempotencyKeyHeader, "key-1")
+	resp, err := safeboxClient.TrusteeKeyPair(header, body)
+	if err != nil {
+		t.Fatalf("trustee key pair error, %v", err)
+	}
+	if resp.Code != "code" {
+		t.Fatalf("trustee key pair return code error")
+	}
+	if !gock.IsDone() {
+		t.Fatalf("expected 2 attempts")
+	}
+}
+
+func TestRetryContextDone(t *testing.T) {
+	p := testRetryPolicy
+	p.InitialBackoff = time.Second
+	p.MaxBackoff = time.Second
+	initTestSafeboxClient(t, WithRetryPolicy(p))
+	defer gock.Off()
+
+	gock.New(safeboxURL).
+		Get(publicURLPath).
+		Reply(http.StatusServiceUnavailable)
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath), &safebox.PublicKeyReply{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := safeboxClient.QueryPublicKeyWithContext(ctx, http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:anx:00001"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if len(gock.Pending()) != 1 {
+		t.Fatalf("expected 1 attempt")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, d := range expected {
+		if b := p.backoff(i + 1); b != d*time.Millisecond {
+			t.Fatalf("attempt %d: expected %v, got %v", i+1, d*time.Millisecond, b)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if b := p.backoff(1); b < 50*time.Millisecond || b > 100*time.Millisecond {
+			t.Fatalf("jittered backoff out of range: %v", b)
+		}
+	}
+}
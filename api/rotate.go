@@ -0,0 +1,196 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// RotateOptions configures RotateKeyPair.
+//
+// Rotating needs a service holding the new key pair alongside the previous
+// one until the previous one is deleted. The safebox service, like the
+// safeboxtest fake, holds a single key pair per DID, and rejects the
+// rotation with ErrUserExists.
+type RotateOptions struct {
+	// Backup persists the previous key pair, e.g. in a keystore file with
+	// keystore.Encrypt and keystore.WriteFile. It is required: RotateKeyPair
+	// calls it before changing anything, and stops if it fails. previous
+	// holds the private key in clear and must be handled accordingly.
+	Backup func(ctx context.Context, previous *safebox.SaveKeyPairRequetBody) error
+}
+
+// RotationError is the error returned by RotateKeyPair once the new key
+// pair has been trusteed. It unwraps to the error of the failed step.
+type RotationError struct {
+	// Op is the failed step, e.g. OpQueryPublicKey.
+	Op string
+	// Err is the error of the failed step.
+	Err error
+	// RollbackErr is the error of the rollback, if it failed.
+	RollbackErr error
+	// Trusteed is the DID and security code of the new key pair, set only
+	// if it is still trusteed: the rollback failed to delete it, so that
+	// the caller can, or the previous key pair may have been deleted, and
+	// the new one is kept.
+	Trusteed *safebox.OperateKeyInfo
+}
+
+// Error implements the error interface.
+func (e *RotationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "safebox: %s: %s failed: %v", OpRotateKeyPair, e.Op, e.Err)
+	switch {
+	case e.RollbackErr != nil:
+		fmt.Fprintf(&b, "; rollback failed, new key pair left trusteed: %v", e.RollbackErr)
+	case e.Trusteed != nil:
+		b.WriteString("; previous key pair may be deleted, new key pair kept")
+	default:
+		b.WriteString("; new key pair deleted, previous key pair untouched")
+	}
+	return b.String()
+}
+
+// Unwrap returns the error of the failed step.
+func (e *RotationError) Unwrap() error {
+	return e.Err
+}
+
+// RotateKeyPair replaces the key pair trusteed for current.UserDid, whose
+// security code is current.Code, with next, and returns the security code
+// of next. next.UserDid may be left empty.
+//
+// The previous key pair is read and handed to opts.Backup first. next is
+// then trusteed and read back with QueryPublicKey, and the previous key
+// pair is only deleted once next is verified, so that the DID always has a
+// trusteed key pair. If next does not match once read back, or the service
+// rejects the deletion of the previous key pair, next is deleted again and
+// a *RotationError is returned: the previous key pair keeps its security
+// code. If the deletion fails otherwise, e.g. its reply is lost, the
+// previous key pair may have been deleted: next is kept, and the
+// *RotationError holds its security code in Trusteed.
+//
+// This needs the service to hold the new key pair alongside the previous
+// one. A service holding a single key pair per DID rejects next: an
+// ErrUserExists error saying so is returned, and nothing is changed.
+//
+// Errors happening before next is trusteed, such as ErrKeyNotFound for a
+// wrong security code, leave the previous key pair untouched and are
+// returned as is.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) RotateKeyPair(ctx context.Context, header http.Header, current *safebox.OperateKeyInfo, next *safebox.SaveKeyPairRequetBody, opts *RotateOptions) (*safebox.SaveKeyPairReply, error) {
+	if current == nil || next == nil {
+		return nil, newError(OpRotateKeyPair, ErrInvalidRequest, fmt.Errorf("request payload is null"))
+	}
+	if current.UserDid == "" || next.PrivateKey == "" || next.PublicKey == "" {
+		return nil, newError(OpRotateKeyPair, ErrInvalidRequest, fmt.Errorf("request information is empty"))
+	}
+	if next.UserDid != "" && next.UserDid != current.UserDid {
+		return nil, newError(OpRotateKeyPair, ErrInvalidRequest, fmt.Errorf("DID of the new key pair does not match"))
+	}
+	if opts == nil || opts.Backup == nil {
+		return nil, newError(OpRotateKeyPair, ErrInvalidRequest, fmt.Errorf("a backup of the previous key pair is required"))
+	}
+	nextBody := *next
+	nextBody.UserDid = current.UserDid
+
+	// Each step gets its own idempotency key, the one of the caller, if
+	// any, cannot be shared by different requests.
+	header = cloneHeader(header)
+	header.Del(IdempotencyKeyHeader)
+
+	// Back up the previous key pair
+	privateReply, err := s.QueryPrivateKeyWithContext(ctx, header, current)
+	if err != nil {
+		return nil, err
+	}
+	publicReply, err := s.QueryPublicKeyWithContext(ctx, header, current)
+	if err != nil {
+		return nil, err
+	}
+	previous := &safebox.SaveKeyPairRequetBody{
+		UserDid:    current.UserDid,
+		PrivateKey: privateReply.PrivateKey,
+		PublicKey:  publicReply.PublicKey,
+	}
+	if err = opts.Backup(ctx, previous); err != nil {
+		return nil, newError(OpRotateKeyPair, nil, fmt.Errorf("back up previous key pair: %w", err))
+	}
+
+	// Store and verify the new key pair
+	reply, err := s.TrusteeKeyPairWithContext(ctx, withIdempotencyKey(header), &nextBody)
+	if stderrors.Is(err, ErrUserExists) {
+		return nil, newError(OpRotateKeyPair, ErrUserExists, fmt.Errorf("the service holds a single key pair per DID, the new key pair cannot be trusteed alongside the previous one: %w", err))
+	}
+	if err != nil {
+		return nil, err
+	}
+	trusteed := &safebox.OperateKeyInfo{UserDid: current.UserDid, Code: reply.Code}
+	stored, err := s.QueryPublicKeyWithContext(ctx, header, trusteed)
+	if err == nil && stored.PublicKey != nextBody.PublicKey {
+		err = newError(OpQueryPublicKey, ErrKeyMismatch, fmt.Errorf("public key read back differs from the new one"))
+	}
+	if err != nil {
+		return nil, s.rollbackRotation(header, trusteed, OpQueryPublicKey, err)
+	}
+
+	// Only then remove the previous key pair
+	if err = s.DeleteKeyPairWithContext(ctx, header, current); rejected(err) {
+		return nil, s.rollbackRotation(header, trusteed, OpDeleteKeyPair, err)
+	}
+	if err != nil {
+		return nil, &RotationError{Op: OpDeleteKeyPair, Err: err, Trusteed: trusteed}
+	}
+	return reply, nil
+}
+
+// rejected reports whether err means the service rejected the request, so
+// that it changed nothing, rather than a failure after which the request
+// may have been applied.
+func rejected(err error) bool {
+	var e *Error
+	if !stderrors.As(err, &e) || stderrors.Is(err, ErrTransport) {
+		return false
+	}
+	return e.ErrCode != 0 || (e.HTTPStatus >= http.StatusBadRequest && e.HTTPStatus < http.StatusInternalServerError)
+}
+
+// rollbackRotation deletes the new key pair. It returns the *RotationError
+// reporting the failure of step op with err.
+func (s *SafeboxClient) rollbackRotation(header http.Header, trusteed *safebox.OperateKeyInfo, op string, err error) error {
+	rerr := &RotationError{Op: op, Err: err}
+
+	// The rollback must run even if the context made the rotation fail
+	if delErr := s.DeleteKeyPairWithContext(context.Background(), header, trusteed); delErr != nil {
+		rerr.RollbackErr, rerr.Trusteed = delErr, trusteed
+	}
+	return rerr
+}
+
+// withIdempotencyKey returns a copy of header with a new idempotency key.
+func withIdempotencyKey(header http.Header) http.Header {
+	h := cloneHeader(header)
+	SetIdempotencyKey(h, NewIdempotencyKey())
+	return h
+}
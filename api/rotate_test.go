@@ -0,0 +1,244 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"github.com/arxanchain/safebox-sdk-go/api/safeboxtest"
+	"github.com/arxanchain/sdk-go-common/errors"
+	restapi "github.com/arxanchain/sdk-go-common/rest/api"
+	rtstructs "github.com/arxanchain/sdk-go-common/rest/structs"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+const (
+	rotateURL = "http://127.0.0.1:8014"
+	rotateDid = "did:anx:00001"
+)
+
+var (
+	oldPair = &safebox.SaveKeyPairRequetBody{UserDid: rotateDid, PrivateKey: "oldprivate", PublicKey: "oldpublic"}
+	newPair = &safebox.SaveKeyPairRequetBody{PrivateKey: "newprivate", PublicKey: "newpublic"}
+	current = &safebox.OperateKeyInfo{UserDid: rotateDid, Code: "code"}
+)
+
+// backups returns rotate options recording the key pairs backed up.
+func backups(saved *[]*safebox.SaveKeyPairRequetBody) *api.RotateOptions {
+	return &api.RotateOptions{Backup: func(ctx context.Context, previous *safebox.SaveKeyPairRequetBody) error {
+		*saved = append(*saved, previous)
+		return nil
+	}}
+}
+
+// newRotateService mocks a service holding the new key pair alongside the
+// previous one, which the safeboxtest fake does not, until readBack is
+// read back with the new security code. The requests deleting a key pair
+// are only answered for the code in deleted.
+func newRotateService(t *testing.T, readBack, deleted string) *api.SafeboxClient {
+	client := &http.Client{Transport: &http.Transport{}}
+	gock.InterceptClient(client)
+	c, err := api.NewSafeboxClient(&restapi.Config{Address: rotateURL, HttpClient: client})
+	if err != nil {
+		t.Fatalf("New safebox client fail: %v", err)
+	}
+
+	payload := func(v interface{}) *rtstructs.Response {
+		b, _ := json.Marshal(v)
+		return &rtstructs.Response{Payload: string(b)}
+	}
+	gock.New(rotateURL).Get(safeboxtest.PrivateURLPath).MatchParam("code", "^code$").
+		Reply(http.StatusOK).JSON(payload(&safebox.PrivateKeyReply{PrivateKey: "oldprivate"}))
+	gock.New(rotateURL).Get(safeboxtest.PublicURLPath).MatchParam("code", "^code$").
+		Reply(http.StatusOK).JSON(payload(&safebox.PublicKeyReply{PublicKey: "oldpublic"}))
+	gock.New(rotateURL).Post(safeboxtest.TrusteeURLPath).
+		Reply(http.StatusOK).JSON(payload(&safebox.SaveKeyPairReply{Code: "newcode"}))
+	gock.New(rotateURL).Get(safeboxtest.PublicURLPath).MatchParam("code", "^newcode$").
+		Reply(http.StatusOK).JSON(payload(&safebox.PublicKeyReply{PublicKey: readBack}))
+	gock.New(rotateURL).Post(safeboxtest.DeleteURLPath).
+		AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+			b, err := ioutil.ReadAll(req.Body)
+			req.Body = ioutil.NopCloser(bytes.NewReader(b))
+			var info safebox.OperateKeyInfo
+			return err == nil && json.Unmarshal(b, &info) == nil && info.Code == deleted, err
+		}).
+		Reply(http.StatusOK).JSON(&rtstructs.Response{})
+	return c
+}
+
+func TestRotateKeyPair(t *testing.T) {
+	defer gock.Off()
+	client := newRotateService(t, "newpublic", "code")
+
+	var saved []*safebox.SaveKeyPairRequetBody
+	reply, err := client.RotateKeyPair(context.Background(), http.Header{}, current, newPair, backups(&saved))
+	if err != nil {
+		t.Fatalf("rotate key pair error, %v", err)
+	}
+	if reply.Code != "newcode" {
+		t.Fatalf("security code should be newcode, got %s", reply.Code)
+	}
+	if len(saved) != 1 || *saved[0] != *oldPair {
+		t.Fatalf("previous key pair should be backed up, got %+v", saved)
+	}
+	// The previous key pair is deleted last
+	if !gock.IsDone() || gock.HasUnmatchedRequest() {
+		t.Fatalf("unexpected requests, pending mocks: %d", len(gock.Pending()))
+	}
+}
+
+func TestRotateKeyPairRollback(t *testing.T) {
+	defer gock.Off()
+	client := newRotateService(t, "tampered", "newcode")
+
+	var saved []*safebox.SaveKeyPairRequetBody
+	_, err := client.RotateKeyPair(context.Background(), http.Header{}, current, newPair, backups(&saved))
+	var rerr *api.RotationError
+	if !stderrors.As(err, &rerr) || !stderrors.Is(err, api.ErrKeyMismatch) {
+		t.Fatalf("expected a key mismatch RotationError, got %v", err)
+	}
+	if rerr.RollbackErr != nil || rerr.Trusteed != nil {
+		t.Fatalf("rollback should succeed, got %v", rerr.RollbackErr)
+	}
+	// Only the new key pair is deleted
+	if !gock.IsDone() || gock.HasUnmatchedRequest() {
+		t.Fatalf("unexpected requests, pending mocks: %d", len(gock.Pending()))
+	}
+}
+
+func TestRotateKeyPairDeleteRejected(t *testing.T) {
+	defer gock.Off()
+	client := newRotateService(t, "newpublic", "newcode")
+	gock.New(rotateURL).Post(safeboxtest.DeleteURLPath).
+		Reply(http.StatusOK).
+		JSON(&rtstructs.Response{ErrCode: errors.UserInfoNotExit, ErrMessage: "user info does not exist"})
+
+	var saved []*safebox.SaveKeyPairRequetBody
+	_, err := client.RotateKeyPair(context.Background(), http.Header{}, current, newPair, backups(&saved))
+	var rerr *api.RotationError
+	if !stderrors.As(err, &rerr) || rerr.Op != api.OpDeleteKeyPair {
+		t.Fatalf("expected a delete RotationError, got %v", err)
+	}
+	// The previous key pair is still there: the new one is deleted
+	if rerr.RollbackErr != nil || rerr.Trusteed != nil {
+		t.Fatalf("rollback should succeed, got %v", rerr.RollbackErr)
+	}
+	if !gock.IsDone() {
+		t.Fatalf("new key pair should be deleted, pending mocks: %d", len(gock.Pending()))
+	}
+}
+
+func TestRotateKeyPairDeleteLost(t *testing.T) {
+	defer gock.Off()
+	client := newRotateService(t, "newpublic", "newcode")
+	gock.New(rotateURL).Post(safeboxtest.DeleteURLPath).
+		ReplyError(fmt.Errorf("connection reset by peer"))
+
+	var saved []*safebox.SaveKeyPairRequetBody
+	_, err := client.RotateKeyPair(context.Background(), http.Header{}, current, newPair, backups(&saved))
+	var rerr *api.RotationError
+	if !stderrors.As(err, &rerr) || !stderrors.Is(err, api.ErrTransport) {
+		t.Fatalf("expected a transport RotationError, got %v", err)
+	}
+	// The previous key pair may be deleted: the new one is kept
+	if rerr.RollbackErr != nil || rerr.Trusteed == nil || rerr.Trusteed.Code != "newcode" {
+		t.Fatalf("new key pair should be kept, got %+v", rerr)
+	}
+	if len(gock.Pending()) != 1 {
+		t.Fatalf("new key pair should not be deleted")
+	}
+}
+
+func TestRotateKeyPairSinglePair(t *testing.T) {
+	srv := safeboxtest.NewServer()
+	defer srv.Close()
+	srv.Seed(oldPair, "code")
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+
+	var saved []*safebox.SaveKeyPairRequetBody
+	_, err = client.RotateKeyPair(context.Background(), http.Header{}, current, newPair, backups(&saved))
+	if !stderrors.Is(err, api.ErrUserExists) {
+		t.Fatalf("expected ErrUserExists, got %v", err)
+	}
+	if len(saved) != 1 {
+		t.Fatalf("previous key pair should be backed up")
+	}
+	if body, code, _ := srv.KeyPair(rotateDid); body.PublicKey != "oldpublic" || code != "code" {
+		t.Fatalf("previous key pair should be untouched")
+	}
+	if n := srv.Requests(safeboxtest.DeleteURLPath); n != 0 {
+		t.Fatalf("nothing should be deleted, got %d delete requests", n)
+	}
+}
+
+func TestRotateKeyPairWrongCode(t *testing.T) {
+	srv := safeboxtest.NewServer()
+	defer srv.Close()
+	srv.Seed(oldPair, "code")
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+
+	var saved []*safebox.SaveKeyPairRequetBody
+	wrong := &safebox.OperateKeyInfo{UserDid: rotateDid, Code: "wrong"}
+	_, err = client.RotateKeyPair(context.Background(), http.Header{}, wrong, newPair, backups(&saved))
+	if !stderrors.Is(err, api.ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+	if len(saved) != 0 || srv.Requests(safeboxtest.TrusteeURLPath) != 0 || srv.Requests(safeboxtest.DeleteURLPath) != 0 {
+		t.Fatalf("nothing should be backed up, trusteed or deleted")
+	}
+}
+
+func TestRotateKeyPairBackup(t *testing.T) {
+	srv := safeboxtest.NewServer()
+	defer srv.Close()
+	srv.Seed(oldPair, "code")
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+
+	_, err = client.RotateKeyPair(context.Background(), http.Header{}, current, newPair, nil)
+	if !stderrors.Is(err, api.ErrInvalidRequest) {
+		t.Fatalf("rotation without backup should fail with ErrInvalidRequest, got %v", err)
+	}
+
+	failed := fmt.Errorf("disk full")
+	_, err = client.RotateKeyPair(context.Background(), http.Header{}, current, newPair, &api.RotateOptions{
+		Backup: func(context.Context, *safebox.SaveKeyPairRequetBody) error { return failed },
+	})
+	if !stderrors.Is(err, failed) {
+		t.Fatalf("expected the backup error, got %v", err)
+	}
+	if n := srv.Requests(safeboxtest.TrusteeURLPath); n != 0 {
+		t.Fatalf("nothing should be trusteed after a failed backup, got %d requests", n)
+	}
+}
@@ -17,20 +17,100 @@ limitations under the License.
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 
 	restapi "github.com/arxanchain/sdk-go-common/rest/api"
+	"github.com/arxanchain/sdk-go-common/structs/did"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
 )
 
+// SafeboxAPI is the set of operations offered by the safebox service.
+//
+// SafeboxClient implements it against the real service. Code depending on
+// safebox should accept a SafeboxAPI so that it can be unit tested with the
+// programmable fake in the mock package.
+type SafeboxAPI interface {
+	TrusteeKeyPair(header http.Header, body *safebox.SaveKeyPairRequetBody) (*safebox.SaveKeyPairReply, error)
+	QueryPrivateKey(header http.Header, info *safebox.OperateKeyInfo) (*safebox.PrivateKeyReply, error)
+	QueryPublicKey(header http.Header, info *safebox.OperateKeyInfo) (*safebox.PublicKeyReply, error)
+	DeleteKeyPair(header http.Header, body *safebox.OperateKeyInfo) error
+	UpdateAssistCode(header http.Header, body *safebox.UpdateSecurityCodeRequestBody) error
+	RecoverAssistCode(header http.Header, id did.Identifier) (*safebox.CodeInfoReply, error)
+
+	TrusteeKeyPairWithContext(ctx context.Context, header http.Header, body *safebox.SaveKeyPairRequetBody) (*safebox.SaveKeyPairReply, error)
+	QueryPrivateKeyWithContext(ctx context.Context, header http.Header, info *safebox.OperateKeyInfo) (*safebox.PrivateKeyReply, error)
+	QueryPublicKeyWithContext(ctx context.Context, header http.Header, info *safebox.OperateKeyInfo) (*safebox.PublicKeyReply, error)
+	DeleteKeyPairWithContext(ctx context.Context, header http.Header, body *safebox.OperateKeyInfo) error
+	UpdateAssistCodeWithContext(ctx context.Context, header http.Header, body *safebox.UpdateSecurityCodeRequestBody) error
+	RecoverAssistCodeWithContext(ctx context.Context, header http.Header, id did.Identifier) (*safebox.CodeInfoReply, error)
+
+	DeleteKeyPairConfirmed(ctx context.Context, header http.Header, body *safebox.OperateKeyInfo) (*Confirmation, error)
+	UpdateAssistCodeConfirmed(ctx context.Context, header http.Header, body *safebox.UpdateSecurityCodeRequestBody) (*Confirmation, error)
+}
+
+var _ SafeboxAPI = (*SafeboxClient)(nil)
+
+// Operation names of the safebox API, as reported in Error.Op.
+const (
+	OpTrusteeKeyPair     = "TrusteeKeyPair"
+	OpQueryPrivateKey    = "QueryPrivateKey"
+	OpQueryPublicKey     = "QueryPublicKey"
+	OpDeleteKeyPair      = "DeleteKeyPair"
+	OpUpdateAssistCode   = "UpdateAssistCode"
+	OpRecoverAssistCode  = "RecoverAssistCode"
+	OpRotateKeyPair      = "RotateKeyPair"
+	OpVerifyTrusteedPair = "VerifyTrusteedPair"
+	OpExportKeystore     = "ExportKeystore"
+	OpImportKeystore     = "ImportKeystore"
+	OpMigrate            = "Migrate"
+)
+
+// Confirmation is the reply of the operations that have no dedicated reply
+// type, returned by DeleteKeyPairConfirmed and UpdateAssistCodeConfirmed.
+type Confirmation struct {
+	// Payload is the string encoded payload sent by the service, empty if
+	// the service sent none.
+	Payload string
+}
+
+// Decode unmarshals the confirmation payload into v.
+func (c *Confirmation) Decode(v interface{}) error {
+	if c.Payload == "" {
+		return fmt.Errorf("confirmation has no payload")
+	}
+	return json.Unmarshal([]byte(c.Payload), v)
+}
+
 // SafeboxClient is a http agent to safebox service.
 //
 type SafeboxClient struct {
-	c *restapi.Client
+	c          *restapi.Client
+	transport  *contextTransport
+	retry      *RetryPolicy
+	replays    *replayCache
+	keyWrapper KeyWrapper
+	publicKeys *publicKeyCache
+	middleware []Middleware
+	routeTag   string
+	// lockSecrets makes the returned Secrets use locked memory.
+	lockSecrets bool
+	// verifyKeyPairs makes TrusteeKeyPair check key pairs before sending.
+	verifyKeyPairs bool
+	endpoints      *endpointPool
+	// optionErr is the error of an invalid option.
+	optionErr error
 }
 
+// ClientOption configures optional behaviour of a SafeboxClient.
+type ClientOption func(*SafeboxClient)
+
 // NewSafeboxClient returns a SafeboxClient instance.
 //
-func NewSafeboxClient(config *restapi.Config) (*SafeboxClient, error) {
+func NewSafeboxClient(config *restapi.Config, opts ...ClientOption) (*SafeboxClient, error) {
 	if config == nil {
 		return nil, fmt.Errorf("config is nil")
 	}
@@ -38,9 +118,43 @@ func NewSafeboxClient(config *restapi.Config) (*SafeboxClient, error) {
 		config.RouteTag = "safebox"
 	}
 
-	c, err := restapi.NewClient(config)
+	// The http client is wrapped so that requests honour the context they
+	// are issued with. The caller's config is left untouched.
+	cfg := *config
+	httpClient, transport := withContextClient(config.HttpClient)
+	cfg.HttpClient = httpClient
+
+	s := &SafeboxClient{
+		transport: transport,
+		replays:   newReplayCache(),
+		routeTag:  cfg.RouteTag,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.optionErr != nil {
+		return nil, s.optionErr
+	}
+
+	// Requests are built for the configured address, the endpoint pool
+	// sends them to the endpoint it selects
+	if s.endpoints != nil {
+		if cfg.Address == "" {
+			cfg.Address = s.endpoints.endpoints[0].address
+		}
+		scheme := cfg.Scheme
+		if i := strings.Index(cfg.Address, "://"); i > 0 {
+			scheme = cfg.Address[:i]
+		}
+		s.endpoints.start(transport.base, scheme)
+		transport.base = s.endpoints
+	}
+
+	c, err := restapi.NewClient(&cfg)
 	if err != nil {
+		s.Close()
 		return nil, err
 	}
-	return &SafeboxClient{c: c}, nil
+	s.c = c
+	return s, nil
 }
@@ -17,10 +17,14 @@ limitations under the License.
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"testing"
 
 	"github.com/arxanchain/sdk-go-common/rest/api"
+	rtstructs "github.com/arxanchain/sdk-go-common/rest/structs"
 	gock "gopkg.in/h2non/gock.v1"
 )
 
@@ -41,16 +45,39 @@ var (
 	safeboxClient *SafeboxClient
 )
 
-func initTestSafeboxClient(t *testing.T) {
+func initTestSafeboxClient(t *testing.T, opts ...ClientOption) {
 	client := &http.Client{Transport: &http.Transport{}}
 	gock.InterceptClient(client)
 	var err error
-	safeboxClient, err = NewSafeboxClient(&api.Config{Address: safeboxURL, HttpClient: client})
+	safeboxClient, err = NewSafeboxClient(&api.Config{Address: safeboxURL, HttpClient: client}, opts...)
 	if err != nil {
 		t.Fatalf("New safebox client fail: %v", err)
 	}
 }
 
+// mockPayload makes mock reply with the envelope of a successful reply
+// carrying payload.
+func mockPayload(t *testing.T, mock *gock.Request, payload interface{}) *gock.Response {
+	byPayload, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return mock.Reply(http.StatusOK).JSON(&rtstructs.Response{Payload: string(byPayload)})
+}
+
+// decodeBody returns a gock matcher decoding the JSON body of the request
+// into v. It matches any request whose body decodes.
+func decodeBody(v interface{}) gock.MatchFunc {
+	return func(req *http.Request, _ *gock.Request) (bool, error) {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return false, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+		return json.Unmarshal(b, v) == nil, nil
+	}
+}
+
 func TestNewSafeboxClientSucc(t *testing.T) {
 	initTestSafeboxClient(t)
 }
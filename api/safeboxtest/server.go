@@ -0,0 +1,439 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package safeboxtest provides an in-process fake safebox service for
+// integration tests.
+//
+// The fake speaks the same wire protocol as the real service: the same
+// routes, the reststruct.Response envelope with string encoded payloads and
+// the same ErrCode values. Like the service, it reports an unknown DID and a
+// wrong security code alike, with errors.UserInfoNotExit, and answers
+// failures with the ErrCode as http status; http cannot carry a status above
+// 999, so replies with such an ErrCode are sent with status 500 instead.
+// Requests the service rejects without a safebox ErrCode, such as those
+// with an invalid API key, get a bare http status.
+//
+// Key pairs are kept in memory, so a test can drive
+// a real api.SafeboxClient through a whole trustee, query, update code and
+// delete cycle:
+//
+//	srv := safeboxtest.NewServer()
+//	defer srv.Close()
+//
+//	client, err := srv.NewClient()
+//	...
+//	reply, err := client.TrusteeKeyPair(header, body)
+package safeboxtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"github.com/arxanchain/safebox-sdk-go/api/internal/fingerprint"
+	"github.com/arxanchain/sdk-go-common/errors"
+	restapi "github.com/arxanchain/sdk-go-common/rest/api"
+	reststruct "github.com/arxanchain/sdk-go-common/rest/structs"
+	"github.com/arxanchain/sdk-go-common/structs"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// Routes served by the fake.
+const (
+	TrusteeURLPath     = "/v1/keypair/save"
+	PrivateURLPath     = "/v1/keypair/private"
+	PublicURLPath      = "/v1/keypair/public"
+	DeleteURLPath      = "/v1/keypair/delete"
+	UpdateCodeURLPath  = "/v1/code/update"
+	RecoverCodeURLPath = "/v1/code"
+)
+
+// Failure describes a canned failure returned instead of the normal reply.
+type Failure struct {
+	// Status is the http status code, http.StatusOK if zero.
+	Status int
+	// Response is the envelope written as body. Nothing is written if nil.
+	Response *reststruct.Response
+	// Times is the number of requests the failure applies to. Zero means
+	// every request until ClearFailures is called.
+	Times int
+}
+
+// Hook is called for every request before it is served. Returning true
+// means the hook has written the response itself and the fake does nothing
+// more with the request.
+type Hook func(w http.ResponseWriter, r *http.Request) bool
+
+type replay struct {
+	fingerprint string
+	reply       safebox.SaveKeyPairReply
+}
+
+type keyPair struct {
+	privateKey string
+	publicKey  string
+	code       string
+}
+
+// Server is a fake safebox service backed by an httptest.Server.
+//
+// It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	// APIKey, when not empty, must be sent in the structs.APIKeyHeader header
+	// of every request, otherwise the request is rejected with
+	// http.StatusUnauthorized.
+	APIKey string
+
+	mu       sync.Mutex
+	keyPairs map[string]*keyPair
+	replays  map[string]*replay
+	latency  time.Duration
+	failures map[string]*Failure
+	hooks    []Hook
+	requests map[string]int
+}
+
+// NewServer starts and returns a new fake safebox service. The caller should
+// call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		keyPairs: make(map[string]*keyPair),
+		replays:  make(map[string]*replay),
+		failures: make(map[string]*Failure),
+		requests: make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(TrusteeURLPath, s.route("POST", s.trusteeKeyPair))
+	mux.HandleFunc(PrivateURLPath, s.route("GET", s.queryPrivateKey))
+	mux.HandleFunc(PublicURLPath, s.route("GET", s.queryPublicKey))
+	mux.HandleFunc(DeleteURLPath, s.route("POST", s.deleteKeyPair))
+	mux.HandleFunc(UpdateCodeURLPath, s.route("POST", s.updateCode))
+	mux.HandleFunc(RecoverCodeURLPath, s.route("GET", s.recoverCode))
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Config returns a client configuration pointing to the fake.
+func (s *Server) Config() *restapi.Config {
+	return &restapi.Config{
+		Address:    s.URL,
+		ApiKey:     s.APIKey,
+		HttpClient: s.Client(),
+	}
+}
+
+// NewClient returns a SafeboxClient talking to the fake.
+func (s *Server) NewClient(opts ...api.ClientOption) (*api.SafeboxClient, error) {
+	return api.NewSafeboxClient(s.Config(), opts...)
+}
+
+// SetLatency delays every reply by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	s.latency = d
+	s.mu.Unlock()
+}
+
+// InjectFailure makes requests to path fail as described by f.
+func (s *Server) InjectFailure(path string, f Failure) {
+	s.mu.Lock()
+	s.failures[path] = &f
+	s.mu.Unlock()
+}
+
+// ClearFailures removes every failure set by InjectFailure.
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	s.failures = make(map[string]*Failure)
+	s.mu.Unlock()
+}
+
+// AddHook registers a hook called for every request, in registration order.
+func (s *Server) AddHook(h Hook) {
+	s.mu.Lock()
+	s.hooks = append(s.hooks, h)
+	s.mu.Unlock()
+}
+
+// Requests returns the number of requests received on path.
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// Seed stores a key pair protected by code, as if it had been trusteed.
+func (s *Server) Seed(body *safebox.SaveKeyPairRequetBody, code string) {
+	s.mu.Lock()
+	s.keyPairs[body.UserDid] = &keyPair{
+		privateKey: body.PrivateKey,
+		publicKey:  body.PublicKey,
+		code:       code,
+	}
+	s.mu.Unlock()
+}
+
+// KeyPair returns the key pair stored for userDid and its security code.
+func (s *Server) KeyPair(userDid string) (body *safebox.SaveKeyPairRequetBody, code string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kp, ok := s.keyPairs[userDid]
+	if !ok {
+		return nil, "", false
+	}
+	body = &safebox.SaveKeyPairRequetBody{
+		UserDid:    userDid,
+		PrivateKey: kp.privateKey,
+		PublicKey:  kp.publicKey,
+	}
+	return body, kp.code, true
+}
+
+// route wraps a handler with method checking, authentication, latency,
+// hooks and injected failures.
+func (s *Server) route(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		latency := s.latency
+		hooks := append([]Hook(nil), s.hooks...)
+		var failure *Failure
+		if f, ok := s.failures[r.URL.Path]; ok {
+			copied := *f
+			failure = &copied
+			if f.Times > 0 {
+				f.Times--
+				if f.Times == 0 {
+					delete(s.failures, r.URL.Path)
+				}
+			}
+		}
+		s.mu.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		for _, hook := range hooks {
+			if hook(w, r) {
+				return
+			}
+		}
+		if failure != nil {
+			status := failure.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			writeResponse(w, status, failure.Response)
+			return
+		}
+		if r.Method != method {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if s.APIKey != "" && r.Header.Get(structs.APIKeyHeader) != s.APIKey {
+			writeResponse(w, http.StatusUnauthorized, nil)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// trusteeKeyPair stores a new key pair. A request carrying an idempotency
+// key already used for the same body is answered with the original reply;
+// a key used for another body is rejected.
+func (s *Server) trusteeKeyPair(w http.ResponseWriter, r *http.Request) {
+	var body safebox.SaveKeyPairRequetBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.UserDid == "" {
+		writeInvalidParams(w)
+		return
+	}
+	key := r.Header.Get(api.IdempotencyKeyHeader)
+	sum := fingerprint.Trustee(&body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rp, ok := s.replays[key]; key != "" && ok {
+		if rp.fingerprint != sum {
+			writeResponse(w, http.StatusUnprocessableEntity, nil)
+			return
+		}
+		WritePayload(w, &rp.reply)
+		return
+	}
+	if _, ok := s.keyPairs[body.UserDid]; ok {
+		writeError(w, errors.UserInfoIsExist, "user info already exists")
+		return
+	}
+	code := newSecurityCode()
+	s.keyPairs[body.UserDid] = &keyPair{
+		privateKey: body.PrivateKey,
+		publicKey:  body.PublicKey,
+		code:       code,
+	}
+	reply := safebox.SaveKeyPairReply{Code: code}
+	if key != "" {
+		s.replays[key] = &replay{fingerprint: sum, reply: reply}
+	}
+	WritePayload(w, &reply)
+}
+
+func (s *Server) queryPrivateKey(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kp, ok := s.authorize(w, r.URL.Query().Get("user_did"), r.URL.Query().Get("code"))
+	if !ok {
+		return
+	}
+	WritePayload(w, &safebox.PrivateKeyReply{PrivateKey: kp.privateKey})
+}
+
+func (s *Server) queryPublicKey(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kp, ok := s.authorize(w, r.URL.Query().Get("user_did"), r.URL.Query().Get("code"))
+	if !ok {
+		return
+	}
+	WritePayload(w, &safebox.PublicKeyReply{PublicKey: kp.publicKey})
+}
+
+func (s *Server) deleteKeyPair(w http.ResponseWriter, r *http.Request) {
+	var body safebox.OperateKeyInfo
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeInvalidParams(w)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.authorize(w, body.UserDid, body.Code); !ok {
+		return
+	}
+	delete(s.keyPairs, body.UserDid)
+	writeResponse(w, http.StatusOK, &reststruct.Response{ErrCode: errors.SuccCode})
+}
+
+func (s *Server) updateCode(w http.ResponseWriter, r *http.Request) {
+	var body safebox.UpdateSecurityCodeRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.NewCode == "" {
+		writeInvalidParams(w)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kp, ok := s.authorize(w, body.UserDid, body.OriginalCode)
+	if !ok {
+		return
+	}
+	kp.code = body.NewCode
+	writeResponse(w, http.StatusOK, &reststruct.Response{ErrCode: errors.SuccCode})
+}
+
+func (s *Server) recoverCode(w http.ResponseWriter, r *http.Request) {
+	userDid := r.URL.Query().Get("user_did")
+	s.mu.Lock()
+	kp, ok := s.keyPairs[userDid]
+	var code string
+	if ok {
+		code = kp.code
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeUserNotExist(w)
+		return
+	}
+	WritePayload(w, &safebox.CodeInfoReply{Code: code})
+}
+
+// authorize looks up the key pair of userDid with its security code,
+// writing the error reply if there is none. As with the service, a wrong
+// code cannot be told from an unknown DID.
+//
+// s.mu must be held, until the key pair is no longer used, so that the
+// check and the change of a request are atomic.
+func (s *Server) authorize(w http.ResponseWriter, userDid, code string) (*keyPair, bool) {
+	kp, ok := s.keyPairs[userDid]
+	if !ok || kp.code != code {
+		writeUserNotExist(w)
+		return nil, false
+	}
+	return kp, true
+}
+
+func newSecurityCode() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func writeInvalidParams(w http.ResponseWriter) {
+	writeResponse(w, http.StatusBadRequest, nil)
+}
+
+func writeUserNotExist(w http.ResponseWriter) {
+	writeError(w, errors.UserInfoNotExit, "user info does not exist")
+}
+
+// writeError writes a failure reply with the given ErrCode, using it as
+// http status when http allows.
+func writeError(w http.ResponseWriter, code errors.ErrCodeType, msg string) {
+	status := int(code)
+	if status < 100 || status > 999 {
+		status = http.StatusInternalServerError
+	}
+	writeResponse(w, status, &reststruct.Response{
+		ErrCode:    code,
+		ErrMessage: msg,
+	})
+}
+
+// WritePayload writes a successful reply carrying payload, as the service
+// does. Hooks can use it to answer a request themselves.
+func WritePayload(w http.ResponseWriter, payload interface{}) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		writeResponse(w, http.StatusInternalServerError, nil)
+		return
+	}
+	writeResponse(w, http.StatusOK, &reststruct.Response{
+		ErrCode: errors.SuccCode,
+		Payload: string(b),
+	})
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp *reststruct.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if resp != nil {
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,333 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package safeboxtest
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"github.com/arxanchain/sdk-go-common/errors"
+	reststruct "github.com/arxanchain/sdk-go-common/rest/structs"
+	"github.com/arxanchain/sdk-go-common/structs"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+const (
+	apiKey  = "1234567890"
+	userDid = "did:anx:00001"
+)
+
+func newHeader() http.Header {
+	header := http.Header{}
+	header.Set(structs.APIKeyHeader, apiKey)
+	return header
+}
+
+func TestKeyPairLifecycle(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.APIKey = apiKey
+
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+	header := newHeader()
+
+	saved, err := client.TrusteeKeyPair(header, &safebox.SaveKeyPairRequetBody{
+		UserDid:    userDid,
+		PrivateKey: "privatekey",
+		PublicKey:  "publickey",
+	})
+	if err != nil {
+		t.Fatalf("trustee key pair error, %v", err)
+	}
+	if saved.Code == "" {
+		t.Fatalf("trustee key pair returns empty code")
+	}
+
+	_, err = client.TrusteeKeyPair(header, &safebox.SaveKeyPairRequetBody{UserDid: userDid})
+	if err == nil {
+		t.Fatalf("trustee key pair twice should fail")
+	}
+
+	info := &safebox.OperateKeyInfo{UserDid: userDid, Code: saved.Code}
+	private, err := client.QueryPrivateKey(header, info)
+	if err != nil || private.PrivateKey != "privatekey" {
+		t.Fatalf("query private key error, %v", err)
+	}
+	public, err := client.QueryPublicKey(header, info)
+	if err != nil || public.PublicKey != "publickey" {
+		t.Fatalf("query public key error, %v", err)
+	}
+
+	err = client.UpdateAssistCode(header, &safebox.UpdateSecurityCodeRequestBody{
+		UserDid:      userDid,
+		OriginalCode: saved.Code,
+		NewCode:      "我爱你中国",
+	})
+	if err != nil {
+		t.Fatalf("update code error, %v", err)
+	}
+	if _, err = client.QueryPrivateKey(header, info); err == nil {
+		t.Fatalf("query private key with old code should fail")
+	}
+	recovered, err := client.RecoverAssistCode(header, userDid)
+	if err != nil || recovered.Code != "我爱你中国" {
+		t.Fatalf("recover code error, %v", err)
+	}
+
+	info.Code = recovered.Code
+	if err = client.DeleteKeyPair(header, info); err != nil {
+		t.Fatalf("delete key pair error, %v", err)
+	}
+	if _, _, ok := srv.KeyPair(userDid); ok {
+		t.Fatalf("key pair still stored after delete")
+	}
+	if _, err = client.QueryPublicKey(header, info); err == nil {
+		t.Fatalf("query public key after delete should fail")
+	}
+}
+
+func TestConcurrentUpdateCode(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Seed(&safebox.SaveKeyPairRequetBody{UserDid: userDid}, "code")
+
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+
+	// Only one update may pass the check of the original code
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		updated []string
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(newCode string) {
+			defer wg.Done()
+			err := client.UpdateAssistCode(http.Header{}, &safebox.UpdateSecurityCodeRequestBody{
+				UserDid:      userDid,
+				OriginalCode: "code",
+				NewCode:      newCode,
+			})
+			if err == nil {
+				mu.Lock()
+				updated = append(updated, newCode)
+				mu.Unlock()
+			}
+		}(fmt.Sprintf("code-%d", i))
+	}
+	wg.Wait()
+	if len(updated) != 1 {
+		t.Fatalf("expected a single update, got %d", len(updated))
+	}
+	if _, code, _ := srv.KeyPair(userDid); code != updated[0] {
+		t.Fatalf("expected code %q, got %q", updated[0], code)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Seed(&safebox.SaveKeyPairRequetBody{UserDid: userDid}, "code")
+
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+	header := newHeader()
+
+	_, err = client.TrusteeKeyPair(header, &safebox.SaveKeyPairRequetBody{UserDid: userDid})
+	if !stderrors.Is(err, api.ErrUserExists) {
+		t.Fatalf("expected user exists error, got %v", err)
+	}
+	// The service does not tell a wrong code from an unknown DID
+	_, err = client.QueryPrivateKey(header, &safebox.OperateKeyInfo{UserDid: userDid, Code: "wrong"})
+	var e *api.Error
+	if !stderrors.Is(err, api.ErrKeyNotFound) || !stderrors.As(err, &e) || e.ErrCode != int(errors.UserInfoNotExit) {
+		t.Fatalf("expected key not found error, got %v", err)
+	}
+	_, err = client.QueryPublicKey(header, &safebox.OperateKeyInfo{UserDid: "did:anx:00002", Code: "code"})
+	if !stderrors.Is(err, api.ErrKeyNotFound) {
+		t.Fatalf("expected key not found error, got %v", err)
+	}
+}
+
+func TestIdempotentTrustee(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	body := &safebox.SaveKeyPairRequetBody{
+		UserDid:    userDid,
+		PrivateKey: "privatekey",
+		PublicKey:  "publickey",
+	}
+	header := newHeader()
+	api.SetIdempotencyKey(header, api.NewIdempotencyKey())
+
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+	first, err := client.TrusteeKeyPair(header, body)
+	if err != nil {
+		t.Fatalf("trustee key pair error, %v", err)
+	}
+
+	// a new client has not seen the reply, the server answers the replay
+	client, err = srv.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+	replayed, err := client.TrusteeKeyPair(header, body)
+	if err != nil {
+		t.Fatalf("trustee key pair replay error, %v", err)
+	}
+	if replayed.Code != first.Code {
+		t.Fatalf("replay should return the original code")
+	}
+	if n := srv.Requests(TrusteeURLPath); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+
+	other := *body
+	other.PublicKey = "otherkey"
+	if _, err = client.TrusteeKeyPair(header, &other); !stderrors.Is(err, api.ErrIdempotencyKeyReused) {
+		t.Fatalf("expected idempotency key reused error, got %v", err)
+	}
+	if _, err = client.TrusteeKeyPair(newHeader(), body); !stderrors.Is(err, api.ErrUserExists) {
+		t.Fatalf("expected user exists error without key, got %v", err)
+	}
+}
+
+func TestKeyEncryption(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	wrapper, err := api.NewAESKeyWrapper("kek-1", make([]byte, 32))
+	if err != nil {
+		t.Fatalf("new key wrapper fail: %v", err)
+	}
+	client, err := srv.NewClient(api.WithKeyEncryption(wrapper))
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+	header := newHeader()
+
+	saved, err := client.TrusteeKeyPair(header, &safebox.SaveKeyPairRequetBody{
+		UserDid:    userDid,
+		PrivateKey: "privatekey",
+		PublicKey:  "publickey",
+	})
+	if err != nil {
+		t.Fatalf("trustee key pair error, %v", err)
+	}
+
+	stored, _, _ := srv.KeyPair(userDid)
+	if !api.IsEncryptedPrivateKey(stored.PrivateKey) {
+		t.Fatalf("private key stored in plaintext")
+	}
+
+	private, err := client.QueryPrivateKey(header, &safebox.OperateKeyInfo{UserDid: userDid, Code: saved.Code})
+	if err != nil {
+		t.Fatalf("query private key error, %v", err)
+	}
+	if private.PrivateKey != "privatekey" {
+		t.Fatalf("private key not decrypted")
+	}
+
+	// without the key-encryption key, the sealed key is returned as is
+	plain, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+	private, err = plain.QueryPrivateKey(header, &safebox.OperateKeyInfo{UserDid: userDid, Code: saved.Code})
+	if err != nil || private.PrivateKey != stored.PrivateKey {
+		t.Fatalf("query private key error, %v", err)
+	}
+}
+
+func TestAPIKeyRequired(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.APIKey = apiKey
+	srv.Seed(&safebox.SaveKeyPairRequetBody{UserDid: userDid}, "code")
+
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+	srv.APIKey = "another key"
+
+	if _, err = client.RecoverAssistCode(newHeader(), userDid); !stderrors.Is(err, api.ErrUnauthorized) {
+		t.Fatalf("expected unauthorized error, got %v", err)
+	}
+}
+
+func TestInjectFailure(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Seed(&safebox.SaveKeyPairRequetBody{UserDid: userDid, PublicKey: "publickey"}, "code")
+
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+	srv.InjectFailure(PublicURLPath, Failure{
+		Response: &reststruct.Response{
+			ErrCode:    errors.UserInfoNotExit,
+			ErrMessage: "user does not exist",
+		},
+		Times: 1,
+	})
+
+	info := &safebox.OperateKeyInfo{UserDid: userDid, Code: "code"}
+	if _, err = client.QueryPublicKey(newHeader(), info); err == nil {
+		t.Fatalf("query public key should fail with injected failure")
+	}
+	if _, err = client.QueryPublicKey(newHeader(), info); err != nil {
+		t.Fatalf("query public key error, %v", err)
+	}
+	if n := srv.Requests(PublicURLPath); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestHook(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddHook(func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusBadGateway)
+		return true
+	})
+
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+	if _, err = client.RecoverAssistCode(newHeader(), userDid); err == nil {
+		t.Fatalf("recover code should fail with hook reply")
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/arxanchain/sdk-go-common/structs/did"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// Secret holds a private key or security code in a buffer that can be
+// wiped with Destroy.
+//
+// A Secret never prints its content: String, fmt verbs and log/slog all
+// show RedactedValue. Its content is only reachable through Bytes.
+//
+// A Secret is safe for concurrent use, but the slice returned by Bytes must
+// not be used after Destroy, nor once the Secret is no longer reachable:
+// the garbage collector then wipes it. Use keeps the Secret alive while its
+// content is used.
+type Secret struct {
+	mu     sync.Mutex
+	b      []byte
+	locked bool
+	free   func()
+}
+
+var (
+	_ fmt.Formatter  = (*Secret)(nil)
+	_ slog.LogValuer = (*Secret)(nil)
+)
+
+// NewSecret returns a Secret holding a copy of b. If locked is true, the
+// buffer is allocated outside the Go heap and locked in memory, so that it
+// is neither moved by the garbage collector nor swapped out; this is only
+// supported on Linux, and silently falls back to a heap buffer if the
+// memory cannot be locked, see Secret.Locked. A locked buffer is only
+// released by Destroy.
+func NewSecret(b []byte, locked bool) *Secret {
+	s := &Secret{}
+	if locked {
+		s.b, s.free = lockedAlloc(len(b))
+		s.locked = s.b != nil
+	}
+	if !s.locked {
+		s.b = make([]byte, len(b))
+	}
+	copy(s.b, b)
+	// Wipe the secret even if Destroy is never called
+	runtime.SetFinalizer(s, (*Secret).finalize)
+	return s
+}
+
+// finalize wipes an unreachable secret. Its buffer is not released, as the
+// slice returned by Bytes may still be in use: unmapping a locked buffer
+// would make it fault.
+func (s *Secret) finalize() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wipe(s.b)
+}
+
+// newSecretString returns a Secret holding a copy of str.
+func newSecretString(str string, locked bool) *Secret {
+	b := []byte(str)
+	defer wipe(b)
+	return NewSecret(b, locked)
+}
+
+// Bytes returns the content of the secret, nil once it is destroyed. The
+// slice is not a copy: it is wiped by Destroy, or once the secret is no
+// longer reachable, so the secret must be kept alive while it is used.
+func (s *Secret) Bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b
+}
+
+// Use calls f with the content of the secret, nil once it is destroyed. The
+// secret is kept alive, and cannot be destroyed, until f returns. f must
+// not retain the slice nor call the methods of the secret.
+func (s *Secret) Use(f func(b []byte)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(s.b)
+	runtime.KeepAlive(s)
+}
+
+// Len returns the length of the secret, zero once it is destroyed.
+func (s *Secret) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.b)
+}
+
+// Locked reports whether the secret is held in locked memory.
+func (s *Secret) Locked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locked
+}
+
+// Destroy wipes the secret and releases its buffer. It is safe to call
+// Destroy several times.
+func (s *Secret) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.b == nil {
+		return
+	}
+	wipe(s.b)
+	if s.free != nil {
+		s.free()
+	}
+	s.b, s.free, s.locked = nil, nil, false
+	runtime.SetFinalizer(s, nil)
+}
+
+// String returns RedactedValue.
+func (s *Secret) String() string {
+	return RedactedValue
+}
+
+// GoString returns RedactedValue.
+func (s *Secret) GoString() string {
+	return RedactedValue
+}
+
+// Format implements fmt.Formatter, printing RedactedValue for every verb.
+func (s *Secret) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, RedactedValue)
+}
+
+// LogValue implements slog.LogValuer.
+func (s *Secret) LogValue() slog.Value {
+	return slog.StringValue(RedactedValue)
+}
+
+// MarshalText fails, so that a Secret is not encoded by accident.
+func (s *Secret) MarshalText() ([]byte, error) {
+	return nil, fmt.Errorf("safebox: secrets cannot be marshaled")
+}
+
+// WithLockedSecrets makes the client allocate the Secrets it returns in
+// locked memory, see NewSecret.
+func WithLockedSecrets() ClientOption {
+	return func(s *SafeboxClient) {
+		s.lockSecrets = true
+	}
+}
+
+// QueryPrivateKeySecret is like QueryPrivateKeyWithContext but returns the
+// private key as a Secret, to be destroyed by the caller once used.
+//
+// The reply is decoded as usual before the private key is copied into the
+// Secret: the transient copies made while decoding cannot be wiped, but are
+// no longer referenced once QueryPrivateKeySecret returns.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) QueryPrivateKeySecret(ctx context.Context, header http.Header, info *safebox.OperateKeyInfo) (*Secret, error) {
+	reply, err := s.QueryPrivateKeyWithContext(ctx, header, info)
+	if err != nil {
+		return nil, err
+	}
+	secret := newSecretString(reply.PrivateKey, s.lockSecrets)
+	reply.PrivateKey = ""
+	return secret, nil
+}
+
+// RecoverAssistCodeSecret is like RecoverAssistCodeWithContext but returns
+// the security code as a Secret, to be destroyed by the caller once used.
+// See QueryPrivateKeySecret.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) RecoverAssistCodeSecret(ctx context.Context, header http.Header, id did.Identifier) (*Secret, error) {
+	reply, err := s.RecoverAssistCodeWithContext(ctx, header, id)
+	if err != nil {
+		return nil, err
+	}
+	secret := newSecretString(reply.Code, s.lockSecrets)
+	reply.Code = ""
+	return secret, nil
+}
@@ -0,0 +1,45 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"syscall"
+)
+
+// lockedAlloc returns a buffer of size n mapped outside the Go heap and
+// locked in memory, and the function releasing it. It returns a nil buffer
+// if the memory cannot be mapped or locked, e.g. because of RLIMIT_MEMLOCK.
+func lockedAlloc(n int) ([]byte, func()) {
+	if n == 0 {
+		return nil, nil
+	}
+	b, err := syscall.Mmap(-1, 0, n, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, nil
+	}
+	if err = syscall.Mlock(b); err != nil {
+		syscall.Munmap(b)
+		return nil, nil
+	}
+	return b, func() {
+		syscall.Munlock(b)
+		syscall.Munmap(b)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestSecret(t *testing.T) {
+	for _, locked := range []bool{false, true} {
+		secret := NewSecret([]byte("privatekey"), locked)
+		if locked && runtime.GOOS == "linux" && !secret.Locked() {
+			t.Logf("memory could not be locked, falling back to the heap")
+		}
+		if string(secret.Bytes()) != "privatekey" || secret.Len() != 10 {
+			t.Fatalf("secret should hold privatekey, got %q", secret.Bytes())
+		}
+
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "%v %+v %#v %s %q %x", secret, secret, secret, secret, secret, secret)
+		slog.New(slog.NewTextHandler(&buf, nil)).Info("test", "secret", secret)
+		if strings.Contains(buf.String(), "privatekey") || strings.Contains(buf.String(), fmt.Sprintf("%x", "privatekey")) {
+			t.Fatalf("secret leaks: %s", buf.String())
+		}
+		if _, err := json.Marshal(secret); err == nil {
+			t.Fatalf("secret should not be marshaled")
+		}
+
+		secret.Use(func(b []byte) {
+			if string(b) != "privatekey" {
+				t.Fatalf("secret should hold privatekey, got %q", b)
+			}
+		})
+
+		b := secret.Bytes()
+		secret.Destroy()
+		secret.Destroy()
+		if secret.Bytes() != nil || secret.Len() != 0 {
+			t.Fatalf("destroyed secret should be empty")
+		}
+		if !locked && !bytes.Equal(b, make([]byte, 10)) {
+			t.Fatalf("destroyed secret should be wiped, got %q", b)
+		}
+	}
+}
+
+func TestSecretFinalize(t *testing.T) {
+	for _, locked := range []bool{false, true} {
+		secret := NewSecret([]byte("privatekey"), locked)
+		b := secret.Bytes()
+
+		// The buffer is wiped but stays mapped
+		secret.finalize()
+		if !bytes.Equal(b, make([]byte, 10)) {
+			t.Fatalf("finalized secret should be wiped, got %q", b)
+		}
+		secret.Destroy()
+	}
+}
+
+func TestQueryPrivateKeySecret(t *testing.T) {
+	initTestSafeboxClient(t, WithLockedSecrets())
+	defer gock.Off()
+	mockPayload(t, gock.New(safeboxURL).Get(privateURLPath), &safebox.PrivateKeyReply{PrivateKey: "privatekey"})
+
+	secret, err := safeboxClient.QueryPrivateKeySecret(context.Background(), http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:1", Code: "code"})
+	if err != nil {
+		t.Fatalf("query private key error, %v", err)
+	}
+	defer secret.Destroy()
+	if string(secret.Bytes()) != "privatekey" {
+		t.Fatalf("secret should hold the private key, got %q", secret.Bytes())
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arxanchain/safebox-sdk-go/keyfmt"
+	"github.com/arxanchain/sdk-go-common/structs/did"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// SignerOptions configures a Signer.
+type SignerOptions struct {
+	// KeyType is the type of the trusteed key pair, see GenerateKeyPair. It
+	// is inferred from the public key if empty, a raw compressed public key
+	// lying on both ECDSA curves being taken as secp256k1.
+	KeyType KeyType
+	// MaxAge is how long the private key is kept after being fetched.
+	// Zero means until Close.
+	MaxAge time.Duration
+	// MaxUses is the number of signatures made before the private key is
+	// wiped. Zero means no limit.
+	MaxUses int
+	// Timeout bounds the fetch of the private key by Sign, which has no
+	// context. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// Signer is a crypto.Signer backed by a key pair trusteed in the safebox.
+//
+// The private key is fetched with QueryPrivateKey on the first signature
+// and wiped once MaxAge has elapsed or MaxUses signatures were made, to be
+// fetched again by the next signature. Close wipes it for good.
+//
+// The keys may be trusteed in any format keyfmt parses. ed25519 keys sign
+// messages: opts.HashFunc() must be zero. P-256 and secp256k1 keys sign
+// digests with ECDSA and return ASN.1 DER signatures, verifiable with
+// crypto/ecdsa and the curve of the public key.
+type Signer struct {
+	client *SafeboxClient
+	header http.Header
+	info   safebox.OperateKeyInfo
+	opts   SignerOptions
+	public *keyfmt.PublicKey
+
+	mu     sync.Mutex
+	key    *keyfmt.PrivateKey
+	uses   int
+	expiry *time.Timer
+	closed bool
+}
+
+var _ crypto.Signer = (*Signer)(nil)
+
+// NewSigner returns a Signer for the key pair trusteed for id, whose
+// security code is code. The public key is fetched right away, the private
+// key only when needed.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) NewSigner(ctx context.Context, header http.Header, id did.Identifier, code string, opts SignerOptions) (*Signer, error) {
+	if id == "" || code == "" {
+		return nil, newError(OpQueryPublicKey, ErrInvalidRequest, fmt.Errorf("request information is empty"))
+	}
+	info := safebox.OperateKeyInfo{UserDid: string(id), Code: code}
+	reply, err := s.QueryPublicKeyWithContext(ctx, header, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := &Signer{
+		client: s,
+		header: cloneHeader(header),
+		info:   info,
+		opts:   opts,
+	}
+	if signer.public, signer.opts.KeyType, err = decodePublicKey(opts.KeyType, reply.PublicKey); err != nil {
+		return nil, newError(OpQueryPublicKey, ErrMalformedPayload, err)
+	}
+	return signer, nil
+}
+
+// Public returns the public key, an ed25519.PublicKey or an
+// *ecdsa.PublicKey on the P-256 or secp256k1 curve.
+func (sg *Signer) Public() crypto.PublicKey {
+	return sg.public.Key()
+}
+
+// Sign signs digest with the private key, fetching it if needed. rand is
+// ignored: ed25519 and secp256k1 signatures are deterministic, P-256
+// signatures use crypto/rand.
+func (sg *Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	ctx := context.Background()
+	if sg.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sg.opts.Timeout)
+		defer cancel()
+	}
+	return sg.SignContext(ctx, digest, opts)
+}
+
+// SignContext is like Sign but binds the fetch of the private key to ctx.
+func (sg *Signer) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	if sg.closed {
+		return nil, fmt.Errorf("safebox: signer is closed")
+	}
+
+	switch sg.opts.KeyType {
+	case KeyTypeEd25519:
+		if opts != nil && opts.HashFunc() != crypto.Hash(0) {
+			return nil, fmt.Errorf("safebox: ed25519 keys sign unhashed messages")
+		}
+	default:
+		if opts == nil || opts.HashFunc() == crypto.Hash(0) || len(digest) != opts.HashFunc().Size() {
+			return nil, fmt.Errorf("safebox: %s keys sign digests of the hash in opts", sg.opts.KeyType)
+		}
+	}
+
+	if sg.key == nil {
+		if err := sg.fetch(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	sig, err := sign(sg.key, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	sg.uses++
+	if sg.opts.MaxUses > 0 && sg.uses >= sg.opts.MaxUses {
+		sg.wipe()
+	}
+	return sig, nil
+}
+
+// Close wipes the private key. The Signer cannot be used afterwards.
+func (sg *Signer) Close() error {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	sg.wipe()
+	sg.closed = true
+	sg.info.Code = ""
+	return nil
+}
+
+// fetch queries and decodes the private key. sg.mu must be held.
+func (sg *Signer) fetch(ctx context.Context) error {
+	secret, err := sg.client.QueryPrivateKeySecret(ctx, sg.header, &sg.info)
+	if err != nil {
+		return err
+	}
+	defer secret.Destroy()
+
+	key, _, err := keyfmt.ParsePrivateKey(secret.Bytes(), sg.public.Algorithm())
+	if err != nil {
+		return newError(OpQueryPrivateKey, ErrMalformedPayload, err)
+	}
+
+	// The private key must match the public key of the signer
+	if !key.Public().Equal(sg.public) {
+		key.Destroy()
+		return newError(OpQueryPrivateKey, ErrKeyMismatch, fmt.Errorf("private key does not match the public key"))
+	}
+	sg.key = key
+
+	sg.uses = 0
+	if sg.opts.MaxAge > 0 {
+		sg.expiry = time.AfterFunc(sg.opts.MaxAge, func() {
+			sg.mu.Lock()
+			defer sg.mu.Unlock()
+			sg.wipe()
+		})
+	}
+	return nil
+}
+
+// wipe zeroes and drops the private key. sg.mu must be held.
+func (sg *Signer) wipe() {
+	if sg.expiry != nil {
+		sg.expiry.Stop()
+		sg.expiry = nil
+	}
+	if sg.key != nil {
+		sg.key.Destroy()
+		sg.key = nil
+	}
+}
+
+// sign signs digest with key.
+func sign(key *keyfmt.PrivateKey, digest []byte) ([]byte, error) {
+	switch k := key.Signer().(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, digest), nil
+	case *ecdsa.PrivateKey:
+		if key.Algorithm() == keyfmt.P256 {
+			return ecdsa.SignASN1(rand.Reader, k, digest)
+		}
+		// secp256k1 signs with RFC 6979 nonces
+		scalar := k.D.FillBytes(make([]byte, secp256k1.PrivKeyBytesLen))
+		defer wipe(scalar)
+		secp := secp256k1.PrivKeyFromBytes(scalar)
+		defer secp.Zero()
+		return secpecdsa.Sign(secp, digest).Serialize(), nil
+	}
+	return nil, fmt.Errorf("safebox: unsupported %s key", key.Algorithm())
+}
+
+// decodePublicKey decodes the public key encoded as described by kt, or in
+// any format keyfmt parses if kt is empty, and returns it with its type.
+func decodePublicKey(kt KeyType, encoded string) (*keyfmt.PublicKey, KeyType, error) {
+	alg, err := kt.algorithm()
+	if err != nil {
+		return nil, kt, err
+	}
+	key, _, err := keyfmt.ParsePublicKey([]byte(encoded), alg)
+	if alg == "" && stderrors.Is(err, keyfmt.ErrAmbiguousAlgorithm) {
+		key, _, err = keyfmt.ParsePublicKey([]byte(encoded), keyfmt.Secp256k1)
+	}
+	if err != nil {
+		return nil, kt, err
+	}
+	return key, keyType(key.Algorithm()), nil
+}
@@ -0,0 +1,197 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	stderrors "errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arxanchain/safebox-sdk-go/keyfmt"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestSignerEd25519(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair(KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	initTestSafeboxClient(t)
+	defer gock.Off()
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath), &safebox.PublicKeyReply{PublicKey: publicKey})
+	mockPayload(t, gock.New(safeboxURL).Get(privateURLPath).Times(2), &safebox.PrivateKeyReply{PrivateKey: privateKey})
+
+	signer, err := safeboxClient.NewSigner(context.Background(), http.Header{}, "did:1", "code", SignerOptions{MaxUses: 2})
+	if err != nil {
+		t.Fatalf("new signer error, %v", err)
+	}
+	defer signer.Close()
+	if len(gock.Pending()) != 1 {
+		t.Fatalf("private key should be fetched lazily")
+	}
+
+	msg := []byte("message")
+	for i := 0; i < 3; i++ {
+		sig, err := signer.Sign(nil, msg, crypto.Hash(0))
+		if err != nil {
+			t.Fatalf("sign error, %v", err)
+		}
+		if !ed25519.Verify(signer.Public().(ed25519.PublicKey), msg, sig) {
+			t.Fatalf("signature should verify")
+		}
+	}
+	// Wiped after 2 uses, fetched again for the third
+	if !gock.IsDone() {
+		t.Fatalf("expected 2 private key queries")
+	}
+
+	if _, err = signer.Sign(nil, msg, crypto.SHA256); err == nil {
+		t.Fatalf("ed25519 signer should refuse hashed messages")
+	}
+}
+
+func TestSignerSecp256k1(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair(KeyTypeSecp256k1)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	initTestSafeboxClient(t)
+	defer gock.Off()
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath), &safebox.PublicKeyReply{PublicKey: publicKey})
+	mockPayload(t, gock.New(safeboxURL).Get(privateURLPath).Times(2), &safebox.PrivateKeyReply{PrivateKey: privateKey})
+
+	signer, err := safeboxClient.NewSigner(context.Background(), http.Header{}, "did:1", "code", SignerOptions{MaxAge: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("new signer error, %v", err)
+	}
+	defer signer.Close()
+
+	digest := sha256.Sum256([]byte("message"))
+	sig, err := signer.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("sign error, %v", err)
+	}
+	if !ecdsa.VerifyASN1(signer.Public().(*ecdsa.PublicKey), digest[:], sig) {
+		t.Fatalf("signature should verify")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err = signer.Sign(nil, digest[:], crypto.SHA256); err != nil {
+		t.Fatalf("sign error, %v", err)
+	}
+	if !gock.IsDone() {
+		t.Fatalf("expired private key should be fetched again")
+	}
+
+	signer.Close()
+	if _, err = signer.Sign(nil, digest[:], crypto.SHA256); err == nil {
+		t.Fatalf("closed signer should fail")
+	}
+}
+
+func TestSignerP256(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair(KeyTypeP256)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	initTestSafeboxClient(t)
+	defer gock.Off()
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath), &safebox.PublicKeyReply{PublicKey: publicKey})
+	mockPayload(t, gock.New(safeboxURL).Get(privateURLPath), &safebox.PrivateKeyReply{PrivateKey: privateKey})
+
+	// A compressed point may lie on both curves: the key type tells
+	signer, err := safeboxClient.NewSigner(context.Background(), http.Header{}, "did:1", "code", SignerOptions{KeyType: KeyTypeP256})
+	if err != nil {
+		t.Fatalf("new signer error, %v", err)
+	}
+	defer signer.Close()
+
+	digest := sha256.Sum256([]byte("message"))
+	sig, err := signer.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("sign error, %v", err)
+	}
+	pub, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() || !ecdsa.VerifyASN1(pub, digest[:], sig) {
+		t.Fatalf("signature should verify with the P-256 public key")
+	}
+}
+
+func TestSignerPEM(t *testing.T) {
+	key, err := keyfmt.NewPrivateKey(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+	if err != nil {
+		t.Fatalf("new private key error, %v", err)
+	}
+	privateKey, err := key.Encode(keyfmt.PEM)
+	if err != nil {
+		t.Fatalf("encode private key error, %v", err)
+	}
+	publicKey, err := key.Public().Encode(keyfmt.JWK)
+	if err != nil {
+		t.Fatalf("encode public key error, %v", err)
+	}
+	initTestSafeboxClient(t)
+	defer gock.Off()
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath), &safebox.PublicKeyReply{PublicKey: string(publicKey)})
+	mockPayload(t, gock.New(safeboxURL).Get(privateURLPath), &safebox.PrivateKeyReply{PrivateKey: string(privateKey)})
+
+	signer, err := safeboxClient.NewSigner(context.Background(), http.Header{}, "did:1", "code", SignerOptions{})
+	if err != nil {
+		t.Fatalf("new signer error, %v", err)
+	}
+	defer signer.Close()
+	msg := []byte("message")
+	sig, err := signer.Sign(nil, msg, crypto.Hash(0))
+	if err != nil {
+		t.Fatalf("sign error, %v", err)
+	}
+	if !ed25519.Verify(signer.Public().(ed25519.PublicKey), msg, sig) {
+		t.Fatalf("signature should verify")
+	}
+}
+
+func TestSignerKeyMismatch(t *testing.T) {
+	privateKey, _, err := GenerateKeyPair(KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	_, publicKey, err := GenerateKeyPair(KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	initTestSafeboxClient(t)
+	defer gock.Off()
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath), &safebox.PublicKeyReply{PublicKey: publicKey})
+	mockPayload(t, gock.New(safeboxURL).Get(privateURLPath), &safebox.PrivateKeyReply{PrivateKey: privateKey})
+
+	signer, err := safeboxClient.NewSigner(context.Background(), http.Header{}, "did:1", "code", SignerOptions{})
+	if err != nil {
+		t.Fatalf("new signer error, %v", err)
+	}
+	defer signer.Close()
+	if _, err = signer.Sign(nil, []byte("message"), crypto.Hash(0)); !stderrors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("expected ErrKeyMismatch, got %v", err)
+	}
+}
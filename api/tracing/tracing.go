@@ -0,0 +1,139 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing provides a SafeboxClient middleware creating an
+// OpenTelemetry span for every safebox operation:
+//
+//	client, err := api.NewSafeboxClient(config, api.WithMiddleware(tracing.Middleware()))
+//
+// Spans are named after the operation, e.g. "safebox.QueryPrivateKey", and
+// carry its route tag, http status, safebox ErrCode and retry count. The
+// W3C trace context is injected in the request headers, so that the gateway
+// can continue the trace.
+//
+// Private keys, security codes and headers are never recorded.
+package tracing
+
+import (
+	"context"
+	stderrors "errors"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer creating the spans.
+const TracerName = "github.com/arxanchain/safebox-sdk-go/api/tracing"
+
+// Attribute keys set on the spans.
+const (
+	OperationKey  = attribute.Key("safebox.operation")
+	UserDidKey    = attribute.Key("safebox.user_did")
+	RouteTagKey   = attribute.Key("safebox.route_tag")
+	ErrCodeKey    = attribute.Key("safebox.err_code")
+	RetryCountKey = attribute.Key("safebox.retry_count")
+	MethodKey     = attribute.Key("http.request.method")
+	PathKey       = attribute.Key("url.path")
+	StatusKey     = attribute.Key("http.response.status_code")
+)
+
+type config struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+	recordDid  bool
+}
+
+// Option configures the tracing middleware.
+type Option func(*config)
+
+// WithTracerProvider sets the provider of the tracer creating the spans. The
+// global provider is used by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = tp
+	}
+}
+
+// WithPropagator sets the propagator injecting the trace context in the
+// request headers. The W3C trace context propagator is used by default.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = p
+	}
+}
+
+// WithoutUserDid keeps the DID of the operations out of the spans.
+func WithoutUserDid() Option {
+	return func(c *config) {
+		c.recordDid = false
+	}
+}
+
+// Middleware returns the api.Middleware tracing every request of a
+// SafeboxClient.
+func Middleware(opts ...Option) api.Middleware {
+	c := &config{
+		provider:   otel.GetTracerProvider(),
+		propagator: propagation.TraceContext{},
+		recordDid:  true,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	tracer := c.provider.Tracer(TracerName)
+
+	return func(next api.Handler) api.Handler {
+		return func(ctx context.Context, call *api.Call) error {
+			attrs := []attribute.KeyValue{
+				OperationKey.String(call.Op),
+				RouteTagKey.String(call.RouteTag),
+				MethodKey.String(call.Method),
+				PathKey.String(call.Path),
+			}
+			if c.recordDid {
+				attrs = append(attrs, UserDidKey.String(call.UserDid))
+			}
+			ctx, span := tracer.Start(ctx, "safebox."+call.Op,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...),
+			)
+			defer span.End()
+			c.propagator.Inject(ctx, propagation.HeaderCarrier(call.Header))
+
+			err := next(ctx, call)
+
+			if call.Attempts > 1 {
+				span.SetAttributes(RetryCountKey.Int(call.Attempts - 1))
+			}
+			if call.HTTPStatus != 0 {
+				span.SetAttributes(StatusKey.Int(call.HTTPStatus))
+			}
+			if err != nil {
+				var e *api.Error
+				if stderrors.As(err, &e) && e.ErrCode != 0 {
+					span.SetAttributes(ErrCodeKey.Int(e.ErrCode))
+				}
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		}
+	}
+}
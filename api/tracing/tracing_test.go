@@ -0,0 +1,120 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"github.com/arxanchain/safebox-sdk-go/api/safeboxtest"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func attr(attrs []attribute.KeyValue, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestMiddleware(t *testing.T) {
+	srv := safeboxtest.NewServer()
+	defer srv.Close()
+	srv.Seed(&safebox.SaveKeyPairRequetBody{UserDid: "did:1", PrivateKey: "privatekey", PublicKey: "publickey"}, "securitycode")
+	var traceparent string
+	srv.AddHook(func(w http.ResponseWriter, r *http.Request) bool {
+		traceparent = r.Header.Get("traceparent")
+		return false
+	})
+	srv.InjectFailure(safeboxtest.PrivateURLPath, safeboxtest.Failure{Status: http.StatusServiceUnavailable, Times: 1})
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	policy := api.DefaultRetryPolicy()
+	policy.InitialBackoff = 0
+	client, err := srv.NewClient(api.WithRetryPolicy(policy), api.WithMiddleware(Middleware(WithTracerProvider(tp))))
+	if err != nil {
+		t.Fatalf("new safebox client fail: %v", err)
+	}
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	_, err = client.QueryPrivateKeyWithContext(ctx, http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:1", Code: "securitycode"})
+	if err != nil {
+		t.Fatalf("query private key error, %v", err)
+	}
+	_, err = client.QueryPublicKeyWithContext(ctx, http.Header{}, &safebox.OperateKeyInfo{UserDid: "did:1", Code: "badcode"})
+	if err == nil {
+		t.Fatalf("query public key with wrong code should fail")
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	query, failed := spans[0], spans[1]
+
+	if query.Name != "safebox."+api.OpQueryPrivateKey || query.SpanKind != trace.SpanKindClient {
+		t.Fatalf("unexpected span %s of kind %v", query.Name, query.SpanKind)
+	}
+	if query.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("span should be a child of the caller span")
+	}
+	if v, _ := attr(query.Attributes, RouteTagKey); v.AsString() != "safebox" {
+		t.Fatalf("route tag should be safebox, got %q", v.AsString())
+	}
+	if v, _ := attr(query.Attributes, RetryCountKey); v.AsInt64() != 1 {
+		t.Fatalf("retry count should be 1, got %d", v.AsInt64())
+	}
+	if v, _ := attr(query.Attributes, StatusKey); v.AsInt64() != http.StatusOK {
+		t.Fatalf("http status should be 200, got %d", v.AsInt64())
+	}
+	if !strings.Contains(traceparent, failed.SpanContext.TraceID().String()) {
+		t.Fatalf("trace context should be propagated, got %q", traceparent)
+	}
+
+	if failed.Status.Code != codes.Error {
+		t.Fatalf("failed span should have an error status")
+	}
+	if v, ok := attr(failed.Attributes, ErrCodeKey); !ok || v.AsInt64() == 0 {
+		t.Fatalf("failed span should carry the ErrCode")
+	}
+	if v, _ := attr(failed.Attributes, StatusKey); v.AsInt64() < http.StatusBadRequest {
+		t.Fatalf("http status should be a failure, got %d", v.AsInt64())
+	}
+
+	// Secrets are never recorded
+	for _, span := range spans {
+		dump := fmt.Sprintf("%v %v %v", span.Attributes, span.Events, span.Status)
+		for _, secret := range []string{"privatekey", "securitycode", "badcode"} {
+			if strings.Contains(dump, secret) {
+				t.Fatalf("span %s records secret %q: %s", span.Name, secret, dump)
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+
+	"github.com/arxanchain/safebox-sdk-go/keyfmt"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// WithKeyPairVerification makes TrusteeKeyPair check, before sending the
+// request, that the public key is the one of the private key. Key pairs
+// are parsed as described by the keyfmt package; a private key that does
+// not parse, e.g. of an unsupported algorithm, is sent unchecked.
+//
+// A mismatch fails with ErrKeyMismatch.
+func WithKeyPairVerification() ClientOption {
+	return func(s *SafeboxClient) {
+		s.verifyKeyPairs = true
+	}
+}
+
+// VerifyTrusteedPair fetches the key pair of info and checks that the
+// public key is still the one of the private key. It returns an error of
+// kind ErrKeyMismatch if not, and of kind ErrMalformedPayload if the
+// private key cannot be parsed, see the keyfmt package.
+//
+// The public key is always queried from the service, bypassing the cache
+// of WithPublicKeyCache.
+//
+// API-Key must set to header.
+func (s *SafeboxClient) VerifyTrusteedPair(ctx context.Context, header http.Header, info *safebox.OperateKeyInfo) error {
+	if info == nil {
+		return newError(OpVerifyTrusteedPair, ErrInvalidRequest, fmt.Errorf("request payload is null"))
+	}
+
+	secret, err := s.QueryPrivateKeySecret(ctx, header, info)
+	if err != nil {
+		return err
+	}
+	defer secret.Destroy()
+	reply, err := s.queryPublicKey(ctx, header, info)
+	if err != nil {
+		return err
+	}
+
+	err = keyfmt.VerifyKeyPair(secret.Bytes(), []byte(reply.PublicKey))
+	switch {
+	case stderrors.Is(err, keyfmt.ErrKeyMismatch):
+		return newError(OpVerifyTrusteedPair, ErrKeyMismatch, err)
+	case err != nil:
+		return newError(OpVerifyTrusteedPair, ErrMalformedPayload, err)
+	}
+	return nil
+}
+
+// verifyKeyPair checks that publicKey is the public key of privateKey. Key
+// pairs whose private key does not parse are not checked.
+func verifyKeyPair(privateKey, publicKey string) error {
+	priv := []byte(privateKey)
+	defer wipe(priv)
+	err := keyfmt.VerifyKeyPair(priv, []byte(publicKey))
+	if stderrors.Is(err, keyfmt.ErrKeyMismatch) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestTrusteeKeyPairVerification(t *testing.T) {
+	initTestSafeboxClient(t, WithKeyPairVerification())
+	defer gock.Off()
+	client := safeboxClient
+	mockPayload(t, gock.New(safeboxURL).Post(trusteeURLPath).Times(2), &safebox.SaveKeyPairReply{Code: "code"})
+
+	privateKey, publicKey, err := GenerateKeyPair(KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	_, otherPublicKey, err := GenerateKeyPair(KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+
+	_, err = client.TrusteeKeyPair(http.Header{}, &safebox.SaveKeyPairRequetBody{
+		UserDid:    "did:1",
+		PrivateKey: privateKey,
+		PublicKey:  otherPublicKey,
+	})
+	if !stderrors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("expected ErrKeyMismatch, got %v", err)
+	}
+	if len(gock.Pending()) != 1 {
+		t.Fatalf("mismatched key pair should not be sent")
+	}
+
+	// Matching and unsupported key pairs are sent
+	for _, body := range []*safebox.SaveKeyPairRequetBody{
+		{UserDid: "did:1", PrivateKey: privateKey, PublicKey: publicKey},
+		{UserDid: "did:2", PrivateKey: "opaque", PublicKey: "opaque"},
+	} {
+		if _, err := client.TrusteeKeyPair(http.Header{}, body); err != nil {
+			t.Fatalf("trustee key pair error, %v", err)
+		}
+	}
+	if !gock.IsDone() {
+		t.Fatalf("expected 2 requests")
+	}
+}
+
+func TestVerifyTrusteedPair(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair(KeyTypeSecp256k1)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	_, otherPublicKey, err := GenerateKeyPair(KeyTypeSecp256k1)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	info := &safebox.OperateKeyInfo{UserDid: "did:1", Code: "code"}
+
+	for _, tc := range []struct {
+		privateKey, publicKey string
+		kind                  error
+	}{
+		{privateKey, publicKey, nil},
+		{privateKey, otherPublicKey, ErrKeyMismatch},
+		{"opaque", publicKey, ErrMalformedPayload},
+	} {
+		initTestSafeboxClient(t)
+		mockPayload(t, gock.New(safeboxURL).Get(privateURLPath), &safebox.PrivateKeyReply{PrivateKey: tc.privateKey})
+		mockPayload(t, gock.New(safeboxURL).Get(publicURLPath), &safebox.PublicKeyReply{PublicKey: tc.publicKey})
+		err = safeboxClient.VerifyTrusteedPair(context.Background(), http.Header{}, info)
+		gock.Off()
+		if tc.kind == nil && err != nil {
+			t.Fatalf("verify trusteed pair error, %v", err)
+		}
+		if tc.kind != nil && !stderrors.Is(err, tc.kind) {
+			t.Fatalf("expected %v, got %v", tc.kind, err)
+		}
+	}
+}
+
+func TestVerifyTrusteedPairCached(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair(KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	_, otherPublicKey, err := GenerateKeyPair(KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("generate key pair error, %v", err)
+	}
+	info := &safebox.OperateKeyInfo{UserDid: "did:1", Code: "code"}
+
+	initTestSafeboxClient(t, WithPublicKeyCache(PublicKeyCacheConfig{TTL: time.Hour}))
+	defer gock.Off()
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath), &safebox.PublicKeyReply{PublicKey: publicKey})
+	if _, err = safeboxClient.QueryPublicKey(http.Header{}, info); err != nil {
+		t.Fatalf("query public key error, %v", err)
+	}
+
+	// The public key changed on the service: the cached one must not be used
+	mockPayload(t, gock.New(safeboxURL).Get(privateURLPath), &safebox.PrivateKeyReply{PrivateKey: privateKey})
+	mockPayload(t, gock.New(safeboxURL).Get(publicURLPath), &safebox.PublicKeyReply{PublicKey: otherPublicKey})
+	err = safeboxClient.VerifyTrusteedPair(context.Background(), http.Header{}, info)
+	if !stderrors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("expected ErrKeyMismatch, got %v", err)
+	}
+	if !gock.IsDone() {
+		t.Fatalf("public key should be queried from the service")
+	}
+}
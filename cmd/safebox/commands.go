@@ -0,0 +1,384 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"github.com/arxanchain/safebox-sdk-go/keystore"
+	"github.com/arxanchain/sdk-go-common/structs/did"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// command is a safebox subcommand.
+type command struct {
+	name    string
+	summary string
+	// secrets lists the secret file flags of the command, by flag name.
+	secrets []secretFlag
+	run     func(a *app, o *options) error
+}
+
+// secretFlag is a flag naming the file a secret is read from.
+type secretFlag struct {
+	name   string
+	usage  string
+	prompt string
+}
+
+// options are the parsed flags of a command run.
+type options struct {
+	clientFlags
+	did       string
+	publicKey string
+	keystore  string
+	kdf       string
+	migrate   migrateFlags
+	secrets   map[string]*string
+}
+
+// result is the output of a command.
+type result struct {
+	UserDid    string `json:"user_did"`
+	Code       string `json:"code,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+	PublicKey  string `json:"public_key,omitempty"`
+	Deleted    bool   `json:"deleted,omitempty"`
+	Updated    bool   `json:"updated,omitempty"`
+	Keystore   string `json:"keystore,omitempty"`
+}
+
+var (
+	privateKeyFlag = secretFlag{"private-key-file", "file holding the private key, \"-\" for stdin", "Private key: "}
+	codeFlag       = secretFlag{"code-file", "file holding the security code, \"-\" for stdin", "Security code: "}
+	newCodeFlag    = secretFlag{"new-code-file", "file holding the new security code, \"-\" for stdin", "New security code: "}
+	passwordFlag   = secretFlag{"password-file", "file holding the keystore password, \"-\" for stdin", "Keystore password: "}
+)
+
+var commands = map[string]*command{
+	"trustee": {
+		name:    "trustee",
+		summary: "trustee a key pair for a DID",
+		secrets: []secretFlag{privateKeyFlag},
+		run:     runTrustee,
+	},
+	"get-private": {
+		name:    "get-private",
+		summary: "query the private key of a DID",
+		secrets: []secretFlag{codeFlag},
+		run:     runGetPrivate,
+	},
+	"get-public": {
+		name:    "get-public",
+		summary: "query the public key of a DID",
+		secrets: []secretFlag{codeFlag},
+		run:     runGetPublic,
+	},
+	"delete": {
+		name:    "delete",
+		summary: "delete the key pair of a DID",
+		secrets: []secretFlag{codeFlag},
+		run:     runDelete,
+	},
+	"recover-code": {
+		name:    "recover-code",
+		summary: "recover the security code of a DID",
+		run:     runRecoverCode,
+	},
+	"update-code": {
+		name:    "update-code",
+		summary: "replace the security code of a DID",
+		secrets: []secretFlag{codeFlag, newCodeFlag},
+		run:     runUpdateCode,
+	},
+	"export": {
+		name:    "export",
+		summary: "export the key pair of a DID to a keystore file",
+		secrets: []secretFlag{codeFlag, passwordFlag},
+		run:     runExport,
+	},
+	"import": {
+		name:    "import",
+		summary: "trustee the key pair of a keystore file",
+		secrets: []secretFlag{passwordFlag},
+		run:     runImport,
+	},
+	"migrate": {
+		name:    "migrate",
+		summary: "copy key pairs to another safebox deployment",
+		run:     runMigrate,
+	},
+}
+
+// flags returns the flag set of the command and the options it fills.
+func (c *command) flags(a *app) (*flag.FlagSet, *options) {
+	o := &options{secrets: map[string]*string{}}
+	fs := flag.NewFlagSet("safebox "+c.name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.StringVar(&o.config, "config", "", "JSON config file (env "+envConfig+")")
+	fs.StringVar(&o.address, "address", "", "safebox service address (env "+envAddress+")")
+	fs.StringVar(&o.apiKey, "api-key", "", "API access key (env "+envAPIKey+")")
+	fs.StringVar(&o.certsPath, "certs-path", "", "client certificates path, enables crypto (env "+envCertsPath+")")
+	fs.DurationVar(&o.timeout, "timeout", 30*time.Second, "request timeout")
+	fs.BoolVar(&o.json, "json", false, "print the result as JSON")
+	fs.StringVar(&o.did, "did", "", "user DID")
+	switch c.name {
+	case "trustee":
+		fs.StringVar(&o.publicKey, "public-key", "", "public key to trustee")
+	case "export":
+		fs.StringVar(&o.keystore, "keystore", "", "keystore file to create")
+		fs.StringVar(&o.kdf, "kdf", string(keystore.Scrypt), "password key derivation function, scrypt or argon2id")
+	case "import":
+		fs.StringVar(&o.keystore, "keystore", "", "keystore file to import, -did defaults to its DID")
+	case "migrate":
+		o.migrate.register(fs)
+	}
+	for _, s := range c.secrets {
+		o.secrets[s.name] = fs.String(s.name, "", s.usage)
+	}
+	return fs, o
+}
+
+// secret reads the secret of flag s.
+func (a *app) secret(o *options, s secretFlag) (string, error) {
+	return a.readSecret(*o.secrets[s.name], s.prompt)
+}
+
+// client returns a SafeboxClient configured from o.
+func (a *app) client(o *options) (*api.SafeboxClient, error) {
+	if o.did == "" {
+		return nil, fmt.Errorf("-did is required")
+	}
+	config, err := o.restConfig(a.getenv)
+	if err != nil {
+		return nil, err
+	}
+	return api.NewSafeboxClient(config)
+}
+
+// context returns a context bounded by the -timeout flag. It is created
+// once the secrets are read, so that the time spent typing them at a prompt
+// does not count.
+func (o *options) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), o.timeout)
+}
+
+// print writes r as JSON if -json is set, otherwise text.
+func (a *app) print(o *options, r *result, text string) error {
+	if o.json {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	_, err := fmt.Fprintln(a.stdout, text)
+	return err
+}
+
+func runTrustee(a *app, o *options) error {
+	if o.publicKey == "" {
+		return fmt.Errorf("-public-key is required")
+	}
+	client, err := a.client(o)
+	if err != nil {
+		return err
+	}
+	privateKey, err := a.secret(o, privateKeyFlag)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	reply, err := client.TrusteeKeyPairWithContext(ctx, http.Header{}, &safebox.SaveKeyPairRequetBody{
+		UserDid:    o.did,
+		PrivateKey: privateKey,
+		PublicKey:  o.publicKey,
+	})
+	if err != nil {
+		return err
+	}
+	return a.print(o, &result{UserDid: o.did, Code: reply.Code}, reply.Code)
+}
+
+func runGetPrivate(a *app, o *options) error {
+	client, err := a.client(o)
+	if err != nil {
+		return err
+	}
+	code, err := a.secret(o, codeFlag)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	reply, err := client.QueryPrivateKeyWithContext(ctx, http.Header{}, &safebox.OperateKeyInfo{UserDid: o.did, Code: code})
+	if err != nil {
+		return err
+	}
+	return a.print(o, &result{UserDid: o.did, PrivateKey: reply.PrivateKey}, reply.PrivateKey)
+}
+
+func runGetPublic(a *app, o *options) error {
+	client, err := a.client(o)
+	if err != nil {
+		return err
+	}
+	code, err := a.secret(o, codeFlag)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	reply, err := client.QueryPublicKeyWithContext(ctx, http.Header{}, &safebox.OperateKeyInfo{UserDid: o.did, Code: code})
+	if err != nil {
+		return err
+	}
+	return a.print(o, &result{UserDid: o.did, PublicKey: reply.PublicKey}, reply.PublicKey)
+}
+
+func runDelete(a *app, o *options) error {
+	client, err := a.client(o)
+	if err != nil {
+		return err
+	}
+	code, err := a.secret(o, codeFlag)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	if err = client.DeleteKeyPairWithContext(ctx, http.Header{}, &safebox.OperateKeyInfo{UserDid: o.did, Code: code}); err != nil {
+		return err
+	}
+	return a.print(o, &result{UserDid: o.did, Deleted: true}, "key pair deleted")
+}
+
+func runRecoverCode(a *app, o *options) error {
+	client, err := a.client(o)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	reply, err := client.RecoverAssistCodeWithContext(ctx, http.Header{}, did.Identifier(o.did))
+	if err != nil {
+		return err
+	}
+	return a.print(o, &result{UserDid: o.did, Code: reply.Code}, reply.Code)
+}
+
+func runUpdateCode(a *app, o *options) error {
+	client, err := a.client(o)
+	if err != nil {
+		return err
+	}
+	code, err := a.secret(o, codeFlag)
+	if err != nil {
+		return err
+	}
+	newCode, err := a.secret(o, newCodeFlag)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	err = client.UpdateAssistCodeWithContext(ctx, http.Header{}, &safebox.UpdateSecurityCodeRequestBody{
+		UserDid:      o.did,
+		OriginalCode: code,
+		NewCode:      newCode,
+	})
+	if err != nil {
+		return err
+	}
+	return a.print(o, &result{UserDid: o.did, Updated: true}, "security code updated")
+}
+
+func runExport(a *app, o *options) error {
+	if o.keystore == "" {
+		return fmt.Errorf("-keystore is required")
+	}
+	kdf := keystore.KDF(o.kdf)
+	if kdf != keystore.Scrypt && kdf != keystore.Argon2id {
+		return fmt.Errorf("-kdf must be scrypt or argon2id")
+	}
+	client, err := a.client(o)
+	if err != nil {
+		return err
+	}
+	code, err := a.secret(o, codeFlag)
+	if err != nil {
+		return err
+	}
+	password, err := a.secret(o, passwordFlag)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	ks, err := client.ExportKeystore(ctx, http.Header{}, &safebox.OperateKeyInfo{UserDid: o.did, Code: code}, []byte(password), &keystore.Options{KDF: kdf})
+	if err != nil {
+		return err
+	}
+	if err := keystore.WriteFile(o.keystore, ks); err != nil {
+		return err
+	}
+	return a.print(o, &result{UserDid: o.did, Keystore: o.keystore}, "key pair exported to "+o.keystore)
+}
+
+func runImport(a *app, o *options) error {
+	if o.keystore == "" {
+		return fmt.Errorf("-keystore is required")
+	}
+	ks, err := keystore.ReadFile(o.keystore)
+	if err != nil {
+		return err
+	}
+	if o.did == "" {
+		o.did = ks.UserDid
+	}
+	if o.did != ks.UserDid {
+		return fmt.Errorf("keystore holds the key pair of %s", ks.UserDid)
+	}
+	client, err := a.client(o)
+	if err != nil {
+		return err
+	}
+	password, err := a.secret(o, passwordFlag)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	reply, err := client.ImportKeystore(ctx, http.Header{}, ks, []byte(password))
+	if err != nil {
+		return err
+	}
+	return a.print(o, &result{UserDid: o.did, Code: reply.Code, Keystore: o.keystore}, reply.Code)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	restapi "github.com/arxanchain/sdk-go-common/rest/api"
+)
+
+// Environment variables read by every command.
+const (
+	envConfig    = "SAFEBOX_CONFIG"
+	envAddress   = "SAFEBOX_ADDRESS"
+	envAPIKey    = "SAFEBOX_API_KEY"
+	envCertsPath = "SAFEBOX_CERTS_PATH"
+)
+
+// fileConfig is the content of the -config file.
+type fileConfig struct {
+	Address   string `json:"address"`
+	APIKey    string `json:"api_key"`
+	CertsPath string `json:"certs_path"`
+}
+
+// clientFlags are the flags shared by every command.
+type clientFlags struct {
+	config    string
+	address   string
+	apiKey    string
+	certsPath string
+	timeout   time.Duration
+	json      bool
+}
+
+// restConfig resolves the client configuration from the flags, the
+// environment and the config file, in that order of precedence.
+func (f *clientFlags) restConfig(getenv func(string) string) (*restapi.Config, error) {
+	var file fileConfig
+	path := first(f.config, getenv(envConfig))
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config: %v", err)
+		}
+		if err = json.Unmarshal(b, &file); err != nil {
+			return nil, fmt.Errorf("parse config %s: %v", path, err)
+		}
+	}
+
+	config := &restapi.Config{
+		Address: first(f.address, getenv(envAddress), file.Address),
+		ApiKey:  first(f.apiKey, getenv(envAPIKey), file.APIKey),
+	}
+	if config.Address == "" {
+		return nil, fmt.Errorf("safebox address is not set, use -address or %s", envAddress)
+	}
+	if certsPath := first(f.certsPath, getenv(envCertsPath), file.CertsPath); certsPath != "" {
+		config.CryptoCfg = &restapi.CryptoConfig{
+			Enable:         true,
+			CertsStorePath: certsPath,
+		}
+	}
+	return config, nil
+}
+
+// first returns the first non-empty value.
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
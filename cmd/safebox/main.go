@@ -0,0 +1,114 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command safebox manages key pairs trusteed in the ArxanChain safebox
+// service.
+//
+// Usage:
+//
+//	safebox <command> [flags]
+//
+// The commands are:
+//
+//	trustee       trustee a key pair for a DID
+//	get-private   query the private key of a DID
+//	get-public    query the public key of a DID
+//	delete        delete the key pair of a DID
+//	recover-code  recover the security code of a DID
+//	update-code   replace the security code of a DID
+//	export        export the key pair of a DID to a keystore file
+//	import        trustee the key pair of a keystore file
+//	migrate       copy key pairs to another safebox deployment
+//
+// The safebox address, API key and client certificates path are read from
+// the -address, -api-key and -certs-path flags, then from the
+// SAFEBOX_ADDRESS, SAFEBOX_API_KEY and SAFEBOX_CERTS_PATH environment
+// variables, then from the JSON file given by -config or SAFEBOX_CONFIG.
+//
+// Private keys, security codes and keystore passwords are never read from
+// the command line: they are read from the file given by the matching
+// -*-file flag ("-" for standard input), or prompted for without echo on the
+// terminal.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// app holds the environment of a command run.
+type app struct {
+	// stdin is shared by every read, so that a command can read several
+	// secrets from it, one per line.
+	stdin  *bufio.Reader
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+	// prompt reads a secret from the terminal without echo.
+	prompt func(msg string) (string, error)
+}
+
+func main() {
+	a := &app{
+		stdin:  bufio.NewReader(os.Stdin),
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		getenv: os.Getenv,
+		prompt: terminalPrompt,
+	}
+	os.Exit(a.run(os.Args[1:]))
+}
+
+// run executes the command line args and returns the exit status.
+func (a *app) run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		a.usage()
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(a.stderr, "safebox: unknown command %q\n", args[0])
+		a.usage()
+		return 2
+	}
+
+	fs, opts := cmd.flags(a)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if err := cmd.run(a, opts); err != nil {
+		fmt.Fprintf(a.stderr, "safebox %s: %v\n", cmd.name, err)
+		return 1
+	}
+	return 0
+}
+
+func (a *app) usage() {
+	fmt.Fprintf(a.stderr, "Usage: safebox <command> [flags]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(a.stderr, "  %-13s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(a.stderr, "\nRun 'safebox <command> -h' for the flags of a command.\n")
+}
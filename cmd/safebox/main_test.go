@@ -0,0 +1,322 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arxanchain/safebox-sdk-go/api/safeboxtest"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// newTestApp returns an app with the given environment and stdin, whose
+// prompt answers from prompts in order.
+func newTestApp(env map[string]string, stdin string, prompts ...string) (*app, *bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	a := &app{
+		stdin:  bufio.NewReader(strings.NewReader(stdin)),
+		stdout: stdout,
+		stderr: stderr,
+		getenv: func(k string) string { return env[k] },
+		prompt: func(msg string) (string, error) {
+			if len(prompts) == 0 {
+				return "", fmt.Errorf("unexpected prompt %q", msg)
+			}
+			p := prompts[0]
+			prompts = prompts[1:]
+			return p, nil
+		},
+	}
+	return a, stdout, stderr
+}
+
+func TestRestConfigPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "safebox")
+	if err != nil {
+		t.Fatalf("create temp dir error, %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(path, []byte(`{"address":"file:9143","api_key":"file-key","certs_path":"/file/certs"}`), 0600)
+	if err != nil {
+		t.Fatalf("write config error, %v", err)
+	}
+
+	env := map[string]string{envConfig: path, envAPIKey: "env-key"}
+	f := &clientFlags{address: "flag:9143"}
+	config, err := f.restConfig(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("restConfig error, %v", err)
+	}
+	if config.Address != "flag:9143" {
+		t.Fatalf("address should come from flags, got %s", config.Address)
+	}
+	if config.ApiKey != "env-key" {
+		t.Fatalf("api key should come from env, got %s", config.ApiKey)
+	}
+	if config.CryptoCfg == nil || !config.CryptoCfg.Enable || config.CryptoCfg.CertsStorePath != "/file/certs" {
+		t.Fatalf("crypto config should come from file, got %+v", config.CryptoCfg)
+	}
+
+	_, err = (&clientFlags{}).restConfig(func(string) string { return "" })
+	if err == nil {
+		t.Fatalf("missing address should fail")
+	}
+}
+
+func TestRunLifecycle(t *testing.T) {
+	server := safeboxtest.NewServer()
+	defer server.Close()
+	env := map[string]string{envAddress: server.URL}
+	const userDid = "did:axn:cli"
+
+	a, stdout, stderr := newTestApp(env, "private-key\n")
+	status := a.run([]string{"trustee", "-did", userDid, "-public-key", "public-key", "-private-key-file", "-", "-json"})
+	if status != 0 {
+		t.Fatalf("trustee failed with status %d: %s", status, stderr)
+	}
+	var res result
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		t.Fatalf("decode trustee output error, %v", err)
+	}
+	if res.UserDid != userDid || res.Code == "" {
+		t.Fatalf("unexpected trustee output %+v", res)
+	}
+	code := res.Code
+
+	a, stdout, stderr = newTestApp(env, "", code)
+	if status = a.run([]string{"get-private", "-did", userDid}); status != 0 {
+		t.Fatalf("get-private failed with status %d: %s", status, stderr)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "private-key" {
+		t.Fatalf("private key should be private-key, got %s", got)
+	}
+
+	a, stdout, stderr = newTestApp(env, "", code)
+	if status = a.run([]string{"get-public", "-did", userDid}); status != 0 {
+		t.Fatalf("get-public failed with status %d: %s", status, stderr)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "public-key" {
+		t.Fatalf("public key should be public-key, got %s", got)
+	}
+
+	// The timeout only starts once the secrets are read
+	a, stdout, stderr = newTestApp(env, "", code)
+	prompt := a.prompt
+	a.prompt = func(msg string) (string, error) {
+		time.Sleep(100 * time.Millisecond)
+		return prompt(msg)
+	}
+	if status = a.run([]string{"get-public", "-did", userDid, "-timeout", "50ms"}); status != 0 {
+		t.Fatalf("get-public after a slow prompt failed with status %d: %s", status, stderr)
+	}
+
+	a, _, stderr = newTestApp(env, "", "wrong-code")
+	if status = a.run([]string{"get-private", "-did", userDid}); status != 1 {
+		t.Fatalf("wrong code should fail with status 1, got %d", status)
+	}
+	if !strings.Contains(stderr.String(), "key pair not found") {
+		t.Fatalf("unexpected error output %s", stderr)
+	}
+
+	a, _, stderr = newTestApp(env, "", code, "new-code")
+	if status = a.run([]string{"update-code", "-did", userDid}); status != 0 {
+		t.Fatalf("update-code failed with status %d: %s", status, stderr)
+	}
+	if _, got, _ := server.KeyPair(userDid); got != "new-code" {
+		t.Fatalf("security code should be new-code, got %s", got)
+	}
+
+	a, _, stderr = newTestApp(env, "new-code")
+	if status = a.run([]string{"delete", "-did", userDid, "-code-file", "-"}); status != 0 {
+		t.Fatalf("delete failed with status %d: %s", status, stderr)
+	}
+	if _, _, ok := server.KeyPair(userDid); ok {
+		t.Fatalf("key pair should be deleted")
+	}
+}
+
+func TestRunSecretsFromStdin(t *testing.T) {
+	source := safeboxtest.NewServer()
+	defer source.Close()
+	target := safeboxtest.NewServer()
+	defer target.Close()
+	const userDid = "did:axn:cli"
+	source.Seed(&safebox.SaveKeyPairRequetBody{UserDid: userDid, PrivateKey: "private-key", PublicKey: "public-key"}, "code")
+	env := map[string]string{envAddress: source.URL}
+
+	a, _, stderr := newTestApp(env, "code\nnew-code\n")
+	if status := a.run([]string{"update-code", "-did", userDid, "-code-file", "-", "-new-code-file", "-"}); status != 0 {
+		t.Fatalf("update-code failed with status %d: %s", status, stderr)
+	}
+	if _, got, _ := source.KeyPair(userDid); got != "new-code" {
+		t.Fatalf("security code should be new-code, got %s", got)
+	}
+
+	dir, err := ioutil.TempDir("", "safebox")
+	if err != nil {
+		t.Fatalf("create temp dir error, %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keystore.json")
+
+	a, _, stderr = newTestApp(env, "new-code\npassword\n")
+	if status := a.run([]string{"export", "-did", userDid, "-keystore", path, "-code-file", "-", "-password-file", "-"}); status != 0 {
+		t.Fatalf("export failed with status %d: %s", status, stderr)
+	}
+	a, _, stderr = newTestApp(map[string]string{envAddress: target.URL}, "", "password")
+	if status := a.run([]string{"import", "-keystore", path}); status != 0 {
+		t.Fatalf("import with the password read from stdin failed with status %d: %s", status, stderr)
+	}
+}
+
+func TestRunExportImport(t *testing.T) {
+	source := safeboxtest.NewServer()
+	defer source.Close()
+	target := safeboxtest.NewServer()
+	defer target.Close()
+	const userDid = "did:axn:cli"
+	source.Seed(&safebox.SaveKeyPairRequetBody{UserDid: userDid, PrivateKey: "private-key", PublicKey: "public-key"}, "code")
+
+	dir, err := ioutil.TempDir("", "safebox")
+	if err != nil {
+		t.Fatalf("create temp dir error, %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keystore.json")
+
+	a, _, stderr := newTestApp(map[string]string{envAddress: source.URL}, "", "code", "password")
+	if status := a.run([]string{"export", "-did", userDid, "-keystore", path, "-kdf", "argon2id"}); status != 0 {
+		t.Fatalf("export failed with status %d: %s", status, stderr)
+	}
+
+	a, stdout, stderr := newTestApp(map[string]string{envAddress: target.URL}, "password\n")
+	if status := a.run([]string{"import", "-keystore", path, "-password-file", "-"}); status != 0 {
+		t.Fatalf("import failed with status %d: %s", status, stderr)
+	}
+	body, code, ok := target.KeyPair(userDid)
+	if !ok || body.PrivateKey != "private-key" || body.PublicKey != "public-key" {
+		t.Fatalf("key pair should be imported, got %+v", body)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != code {
+		t.Fatalf("security code should be %s, got %s", code, got)
+	}
+}
+
+func TestRunMigrate(t *testing.T) {
+	source := safeboxtest.NewServer()
+	defer source.Close()
+	target := safeboxtest.NewServer()
+	defer target.Close()
+	for _, userDid := range []string{"did:axn:1", "did:axn:2"} {
+		source.Seed(&safebox.SaveKeyPairRequetBody{UserDid: userDid, PrivateKey: "private-key", PublicKey: "public-key"}, "code")
+	}
+
+	dir, err := ioutil.TempDir("", "safebox")
+	if err != nil {
+		t.Fatalf("create temp dir error, %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "report.json")
+
+	input := "# did code\ndid:axn:1 code\n\ndid:axn:2 wrong\n"
+	a, stdout, stderr := newTestApp(map[string]string{envAddress: source.URL}, input)
+	status := a.run([]string{"migrate", "-to-address", target.URL, "-input", "-", "-report", path, "-delete-source"})
+	if status != 1 {
+		t.Fatalf("migrate with a failure should exit with status 1, got %d: %s", status, stderr)
+	}
+	_, code, ok := target.KeyPair("did:axn:1")
+	if !ok || !strings.Contains(stdout.String(), "did:axn:1 ok "+code) {
+		t.Fatalf("did:axn:1 should be migrated, got %s", stdout)
+	}
+	if !strings.Contains(stdout.String(), "did:axn:2 failed read") {
+		t.Fatalf("did:axn:2 should fail, got %s", stdout)
+	}
+	if _, _, ok := source.KeyPair("did:axn:1"); ok {
+		t.Fatalf("did:axn:1 should be deleted from the source")
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read report error, %v", err)
+	}
+	var report struct {
+		Results []struct {
+			UserDid string `json:"user_did"`
+			Code    string `json:"code"`
+			Error   string `json:"error"`
+		} `json:"results"`
+		Succeeded int `json:"succeeded"`
+		Failed    int `json:"failed"`
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatalf("decode report error, %v", err)
+	}
+	if report.Succeeded != 1 || report.Failed != 1 || report.Results[0].Code != code || report.Results[1].Error == "" {
+		t.Fatalf("unexpected report %s", b)
+	}
+}
+
+func TestRunMigrateTimeouts(t *testing.T) {
+	source := safeboxtest.NewServer()
+	defer source.Close()
+	target := safeboxtest.NewServer()
+	defer target.Close()
+	var input string
+	for i := 0; i < 4; i++ {
+		userDid := fmt.Sprintf("did:axn:%d", i)
+		source.Seed(&safebox.SaveKeyPairRequetBody{UserDid: userDid, PrivateKey: "private-key", PublicKey: "public-key"}, "code")
+		input += userDid + " code\n"
+	}
+	source.SetLatency(40 * time.Millisecond)
+	env := map[string]string{envAddress: source.URL}
+
+	// -timeout bounds each request, not the whole migration
+	a, _, stderr := newTestApp(env, input)
+	status := a.run([]string{"migrate", "-to-address", target.URL, "-input", "-", "-concurrency", "1", "-timeout", "150ms"})
+	if status != 0 {
+		t.Fatalf("migrate failed with status %d: %s", status, stderr)
+	}
+
+	a, _, stderr = newTestApp(env, input)
+	status = a.run([]string{"migrate", "-to-address", target.URL, "-input", "-", "-concurrency", "1", "-deadline", "60ms"})
+	if status != 1 {
+		t.Fatalf("migrate past its deadline should exit with status 1, got %d: %s", status, stderr)
+	}
+	if !strings.Contains(stderr.String(), "context deadline exceeded") {
+		t.Fatalf("unexpected error output %s", stderr)
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	a, _, stderr := newTestApp(nil, "")
+	if status := a.run([]string{"unknown"}); status != 2 {
+		t.Fatalf("unknown command should exit with status 2, got %d", status)
+	}
+	if !strings.Contains(stderr.String(), "recover-code") {
+		t.Fatalf("usage should list commands, got %s", stderr)
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arxanchain/safebox-sdk-go/api"
+	"github.com/arxanchain/sdk-go-common/structs/safebox"
+)
+
+// migrateFlags are the flags of the migrate command. The source is
+// configured by the usual client flags, the destination by the -to-*
+// flags only, so that the environment never selects it by accident.
+type migrateFlags struct {
+	to           clientFlags
+	input        string
+	report       string
+	deleteSource bool
+	concurrency  int
+	deadline     time.Duration
+}
+
+func (m *migrateFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&m.to.config, "to-config", "", "JSON config file of the destination")
+	fs.StringVar(&m.to.address, "to-address", "", "destination safebox service address")
+	fs.StringVar(&m.to.apiKey, "to-api-key", "", "destination API access key")
+	fs.StringVar(&m.to.certsPath, "to-certs-path", "", "destination client certificates path, enables crypto")
+	fs.StringVar(&m.input, "input", "", "file listing a DID and its security code per line, \"-\" for stdin")
+	fs.StringVar(&m.report, "report", "", "JSON report file to create, holding the new security codes")
+	fs.BoolVar(&m.deleteSource, "delete-source", false, "delete the migrated key pairs from the source")
+	fs.IntVar(&m.concurrency, "concurrency", api.DefaultBatchConcurrency, "number of key pairs migrated at once")
+	fs.DurationVar(&m.deadline, "deadline", 0, "time limit of the whole migration, none if zero")
+}
+
+// requestTimeout returns a Middleware bounding each request to timeout, so
+// that -timeout applies to every request of a migration rather than to the
+// migration as a whole.
+func requestTimeout(timeout time.Duration) api.Middleware {
+	return func(next api.Handler) api.Handler {
+		return func(ctx context.Context, call *api.Call) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next(ctx, call)
+		}
+	}
+}
+
+// readMigrationInput parses the DIDs and security codes of the -input file:
+// a DID and its code per line, separated by white space. Empty lines and
+// lines starting with # are ignored.
+func (a *app) readMigrationInput(path string) ([]*safebox.OperateKeyInfo, error) {
+	var r io.Reader = a.stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var infos []*safebox.OperateKeyInfo
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("input line %d: expected a DID and a security code", line)
+		}
+		infos = append(infos, &safebox.OperateKeyInfo{UserDid: fields[0], Code: fields[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, fmt.Errorf("input lists no key pair")
+	}
+	return infos, nil
+}
+
+// writeReport writes the migration report to the file at path, created
+// readable by its owner only.
+func writeReport(path string, report *api.MigrationReport) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runMigrate(a *app, o *options) error {
+	m := &o.migrate
+	if m.input == "" {
+		return fmt.Errorf("-input is required")
+	}
+	srcConfig, err := o.restConfig(a.getenv)
+	if err != nil {
+		return err
+	}
+	dstConfig, err := m.to.restConfig(func(string) string { return "" })
+	if err != nil {
+		return fmt.Errorf("destination: %v", err)
+	}
+	if srcConfig.Address == dstConfig.Address {
+		return fmt.Errorf("source and destination are the same deployment")
+	}
+	infos, err := a.readMigrationInput(m.input)
+	if err != nil {
+		return err
+	}
+
+	timeout := api.WithMiddleware(requestTimeout(o.timeout))
+	src, err := api.NewSafeboxClient(srcConfig, timeout)
+	if err != nil {
+		return err
+	}
+	dst, err := api.NewSafeboxClient(dstConfig, timeout)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if m.deadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, m.deadline)
+	}
+	defer cancel()
+
+	report, err := api.Migrate(ctx, src, http.Header{}, dst, http.Header{}, infos, &api.MigrateOptions{
+		Concurrency:  m.concurrency,
+		DeleteSource: m.deleteSource,
+	})
+	if m.report != "" {
+		if werr := writeReport(m.report, report); werr != nil {
+			return fmt.Errorf("write report: %v", werr)
+		}
+	}
+
+	if o.json {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		if werr := enc.Encode(report); werr != nil {
+			return werr
+		}
+	} else {
+		for _, res := range report.Results {
+			if res.Err != nil {
+				fmt.Fprintf(a.stdout, "%s failed %s: %v\n", res.UserDid, res.FailedStep, res.Err)
+			} else {
+				fmt.Fprintf(a.stdout, "%s ok %s\n", res.UserDid, res.Code)
+			}
+		}
+	}
+	fmt.Fprintf(a.stderr, "%d key pairs migrated, %d failed\n", report.Succeeded, report.Failed)
+
+	if err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d key pairs failed to migrate", report.Failed)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// readSecret returns the secret stored in path, read from stdin if path is
+// "-", or prompted for with msg if path is empty. A single trailing newline
+// is removed.
+func (a *app) readSecret(path, msg string) (string, error) {
+	var secret string
+	switch path {
+	case "":
+		s, err := a.prompt(msg)
+		if err != nil {
+			return "", err
+		}
+		secret = s
+	case "-":
+		s, err := a.stdin.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		secret = s
+	default:
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		secret = string(b)
+	}
+
+	secret = strings.TrimSuffix(strings.TrimSuffix(secret, "\n"), "\r")
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", strings.TrimSuffix(strings.ToLower(msg), ": "))
+	}
+	return secret, nil
+}
+
+// terminalPrompt prints msg on stderr and reads a line from the terminal
+// without echo.
+func terminalPrompt(msg string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("stdin is not a terminal, use the -*-file flags to provide secrets")
+	}
+	fmt.Fprint(os.Stderr, msg)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,143 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyfmt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// jwk is a JSON Web Key of one of the supported algorithms.
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	D   string `json:"d,omitempty"`
+}
+
+// JWK key types and curve names.
+const (
+	jwkOKP     = "OKP"
+	jwkEC      = "EC"
+	jwkEd25519 = "Ed25519"
+)
+
+var jwkEncoding = base64.RawURLEncoding
+
+// newJWK returns the JWK of public key k.
+func newJWK(k *PublicKey) *jwk {
+	switch key := k.key.(type) {
+	case ed25519.PublicKey:
+		return &jwk{Kty: jwkOKP, Crv: jwkEd25519, X: jwkEncoding.EncodeToString(key)}
+	case *ecdsa.PublicKey:
+		return &jwk{
+			Kty: jwkEC,
+			Crv: string(k.alg),
+			X:   jwkEncoding.EncodeToString(key.X.FillBytes(make([]byte, ecScalarSize))),
+			Y:   jwkEncoding.EncodeToString(key.Y.FillBytes(make([]byte, ecScalarSize))),
+		}
+	}
+	return nil
+}
+
+// encodeJWKPrivateKey returns the JWK encoding of k.
+func encodeJWKPrivateKey(k *PrivateKey) ([]byte, error) {
+	out := newJWK(k.Public())
+	switch key := k.key.(type) {
+	case ed25519.PrivateKey:
+		out.D = jwkEncoding.EncodeToString(key.Seed())
+	case *ecdsa.PrivateKey:
+		scalar := key.D.FillBytes(make([]byte, ecScalarSize))
+		defer wipe(scalar)
+		out.D = jwkEncoding.EncodeToString(scalar)
+	}
+	return json.Marshal(out)
+}
+
+// encodeJWKPublicKey returns the JWK encoding of k.
+func encodeJWKPublicKey(k *PublicKey) ([]byte, error) {
+	return json.Marshal(newJWK(k))
+}
+
+// parseJWK decodes a JWK and its public key.
+func parseJWK(data []byte) (*jwk, *PublicKey, error) {
+	var in jwk
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	x, err := jwkEncoding.DecodeString(in.X)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: malformed x", ErrInvalidKey)
+	}
+
+	switch {
+	case in.Kty == jwkOKP && in.Crv == jwkEd25519:
+		pub, err := parseRawPublicKey(x, Ed25519)
+		return &in, pub, err
+	case in.Kty == jwkEC && (in.Crv == string(P256) || in.Crv == string(Secp256k1)):
+		y, err := jwkEncoding.DecodeString(in.Y)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: malformed y", ErrInvalidKey)
+		}
+		pub, err := ecPoint(Algorithm(in.Crv), x, y)
+		return &in, pub, err
+	}
+	return nil, nil, fmt.Errorf("%w: JWK %s key on curve %q", ErrUnsupportedAlgorithm, in.Kty, in.Crv)
+}
+
+// parseJWKPrivateKey parses a JWK private key, checking its public part
+// matches.
+func parseJWKPrivateKey(data []byte) (*PrivateKey, error) {
+	in, pub, err := parseJWK(data)
+	if err != nil {
+		return nil, err
+	}
+	if in.D == "" {
+		return nil, fmt.Errorf("%w: JWK is a public key", ErrInvalidKey)
+	}
+	d, err := jwkEncoding.DecodeString(in.D)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed d", ErrInvalidKey)
+	}
+	defer wipe(d)
+
+	var key *PrivateKey
+	if pub.alg == Ed25519 {
+		if len(d) != ed25519.SeedSize {
+			return nil, fmt.Errorf("%w: %d bytes ed25519 seed", ErrInvalidKey, len(d))
+		}
+		key = &PrivateKey{alg: Ed25519, key: ed25519.NewKeyFromSeed(d)}
+	} else if key, err = ecPrivateKey(pub.alg, d); err != nil {
+		return nil, err
+	}
+	if !key.Public().Equal(pub) {
+		key.Destroy()
+		return nil, fmt.Errorf("%w: public key does not match private key", ErrInvalidKey)
+	}
+	return key, nil
+}
+
+// parseJWKPublicKey parses a JWK public key. The private part of a JWK
+// private key is ignored.
+func parseJWKPublicKey(data []byte) (*PublicKey, error) {
+	_, pub, err := parseJWK(data)
+	return pub, err
+}
@@ -0,0 +1,463 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package keyfmt detects and converts the encodings of ed25519, ECDSA P-256
+// and secp256k1 keys.
+//
+// The safebox stores keys as opaque strings. keyfmt reads and writes them
+// in any of the following formats:
+//
+//   - PEM: PKCS#8 private keys ("PRIVATE KEY", SEC1 "EC PRIVATE KEY" is
+//     accepted when parsing) and SPKI public keys ("PUBLIC KEY").
+//   - JWK: JSON Web Keys, as defined by RFC 8037 for ed25519 and RFC 8812
+//     for secp256k1.
+//   - Hex and Base64: the raw key bytes. ed25519 private keys are the 64
+//     bytes seed followed by public key, ECDSA private keys the 32 bytes
+//     scalar, ed25519 public keys the 32 bytes key and ECDSA public keys
+//     the 33 bytes compressed point. These are the encodings of the
+//     safebox api.KeyType, Base64 being the default.
+//
+// Raw encodings do not always tell the algorithm: a 32 bytes private key
+// may be any of them, and a compressed point usually lies on both curves.
+// Parsing then needs the algorithm as a hint:
+//
+//	key, _, err := keyfmt.ParsePrivateKey([]byte(reply.PrivateKey), keyfmt.Secp256k1)
+//	...
+//	pemKey, err := key.Encode(keyfmt.PEM)
+package keyfmt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Algorithm is the algorithm of a key.
+type Algorithm string
+
+// Supported algorithms.
+const (
+	Ed25519   Algorithm = "ed25519"
+	P256      Algorithm = "P-256"
+	Secp256k1 Algorithm = "secp256k1"
+)
+
+// Format is the encoding of a key.
+type Format string
+
+// Supported formats.
+const (
+	PEM    Format = "pem"
+	JWK    Format = "jwk"
+	Hex    Format = "hex"
+	Base64 Format = "base64"
+)
+
+// Errors returned by the parsing and encoding functions.
+var (
+	// ErrUnknownFormat means the encoding of a key could not be detected,
+	// or a format is not supported.
+	ErrUnknownFormat = errors.New("unknown key format")
+	// ErrUnsupportedAlgorithm means a key uses an algorithm other than
+	// ed25519, P-256 and secp256k1.
+	ErrUnsupportedAlgorithm = errors.New("unsupported key algorithm")
+	// ErrAmbiguousAlgorithm means the algorithm of a raw key cannot be told
+	// from its size and no algorithm was given.
+	ErrAmbiguousAlgorithm = errors.New("ambiguous key algorithm")
+	// ErrInvalidKey means a key is malformed, or does not match the given
+	// algorithm.
+	ErrInvalidKey = errors.New("invalid key")
+)
+
+// PrivateKey is a private key of one of the supported algorithms.
+//
+// A PrivateKey never prints its content: fmt verbs only show its
+// algorithm.
+type PrivateKey struct {
+	alg Algorithm
+	key crypto.Signer
+}
+
+// PublicKey is a public key of one of the supported algorithms.
+type PublicKey struct {
+	alg Algorithm
+	key crypto.PublicKey
+}
+
+// NewPrivateKey wraps key, an ed25519.PrivateKey, an *ecdsa.PrivateKey on
+// the P-256 or secp256k1 curve, or a *secp256k1.PrivateKey. The key is not
+// copied: Destroy wipes it.
+func NewPrivateKey(key crypto.PrivateKey) (*PrivateKey, error) {
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		if len(k) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("%w: ed25519 private key is %d bytes", ErrInvalidKey, len(k))
+		}
+		return &PrivateKey{alg: Ed25519, key: k}, nil
+	case *ecdsa.PrivateKey:
+		alg, err := curveAlgorithm(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &PrivateKey{alg: alg, key: k}, nil
+	case *secp256k1.PrivateKey:
+		return &PrivateKey{alg: Secp256k1, key: k.ToECDSA()}, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedAlgorithm, key)
+	}
+}
+
+// NewPublicKey wraps key, an ed25519.PublicKey, an *ecdsa.PublicKey on the
+// P-256 or secp256k1 curve, or a *secp256k1.PublicKey.
+func NewPublicKey(key crypto.PublicKey) (*PublicKey, error) {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		if len(k) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: ed25519 public key is %d bytes", ErrInvalidKey, len(k))
+		}
+		return &PublicKey{alg: Ed25519, key: k}, nil
+	case *ecdsa.PublicKey:
+		alg, err := curveAlgorithm(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &PublicKey{alg: alg, key: k}, nil
+	case *secp256k1.PublicKey:
+		return &PublicKey{alg: Secp256k1, key: k.ToECDSA()}, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedAlgorithm, key)
+	}
+}
+
+// Algorithm returns the algorithm of k.
+func (k *PrivateKey) Algorithm() Algorithm {
+	return k.alg
+}
+
+// Signer returns the key, an ed25519.PrivateKey or an *ecdsa.PrivateKey.
+func (k *PrivateKey) Signer() crypto.Signer {
+	return k.key
+}
+
+// Public returns the public key of k.
+func (k *PrivateKey) Public() *PublicKey {
+	return &PublicKey{alg: k.alg, key: k.key.Public()}
+}
+
+// Encode returns k encoded in format f.
+func (k *PrivateKey) Encode(f Format) ([]byte, error) {
+	switch f {
+	case PEM:
+		return encodePEMPrivateKey(k)
+	case JWK:
+		return encodeJWKPrivateKey(k)
+	case Hex, Base64:
+		raw := rawPrivateKey(k)
+		defer wipe(raw)
+		return encodeRaw(f, raw), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, f)
+	}
+}
+
+// Destroy wipes the key material of k. k must not be used afterwards.
+func (k *PrivateKey) Destroy() {
+	switch key := k.key.(type) {
+	case ed25519.PrivateKey:
+		wipe(key)
+	case *ecdsa.PrivateKey:
+		words := key.D.Bits()
+		for i := range words {
+			words[i] = 0
+		}
+		key.D.SetInt64(0)
+	}
+}
+
+// String returns a description of k that does not include the key.
+func (k *PrivateKey) String() string {
+	return "keyfmt.PrivateKey(" + string(k.alg) + ")"
+}
+
+// GoString is like String.
+func (k *PrivateKey) GoString() string {
+	return k.String()
+}
+
+// Format prints k as String for any verb, so that the key cannot be
+// printed by accident.
+func (k *PrivateKey) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, k.String())
+}
+
+// Algorithm returns the algorithm of k.
+func (k *PublicKey) Algorithm() Algorithm {
+	return k.alg
+}
+
+// Key returns the key, an ed25519.PublicKey or an *ecdsa.PublicKey.
+func (k *PublicKey) Key() crypto.PublicKey {
+	return k.key
+}
+
+// Equal reports whether k and x are the same key, whatever their
+// encodings.
+func (k *PublicKey) Equal(x *PublicKey) bool {
+	if k.alg != x.alg {
+		return false
+	}
+	switch key := k.key.(type) {
+	case ed25519.PublicKey:
+		return key.Equal(x.key)
+	case *ecdsa.PublicKey:
+		other, ok := x.key.(*ecdsa.PublicKey)
+		return ok && key.X.Cmp(other.X) == 0 && key.Y.Cmp(other.Y) == 0
+	}
+	return false
+}
+
+// Encode returns k encoded in format f.
+func (k *PublicKey) Encode(f Format) ([]byte, error) {
+	switch f {
+	case PEM:
+		return encodePEMPublicKey(k)
+	case JWK:
+		return encodeJWKPublicKey(k)
+	case Hex, Base64:
+		return encodeRaw(f, rawPublicKey(k)), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, f)
+	}
+}
+
+// String returns the algorithm and the Base64 encoding of k.
+func (k *PublicKey) String() string {
+	return "keyfmt.PublicKey(" + string(k.alg) + ", " + base64.StdEncoding.EncodeToString(rawPublicKey(k)) + ")"
+}
+
+// Detect returns the format of data, or an empty Format if it is none of
+// the supported ones. Data made of an even number of hex digits is
+// reported as Hex, even though it may also be valid Base64.
+func Detect(data []byte) Format {
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) == 0:
+		return ""
+	case bytes.HasPrefix(data, []byte("-----BEGIN ")):
+		return PEM
+	case data[0] == '{':
+		return JWK
+	case isHex(data):
+		return Hex
+	}
+	if b, ok := decodeBase64(data); ok {
+		wipe(b)
+		return Base64
+	}
+	return ""
+}
+
+// ParsePrivateKey parses a private key in any supported format, and
+// returns it with the detected format. alg is required to parse raw keys
+// whose size does not tell the algorithm; if not empty, the key must be
+// of that algorithm.
+//
+// Hex data that is not a valid key is retried as Base64.
+func ParsePrivateKey(data []byte, alg Algorithm) (*PrivateKey, Format, error) {
+	if err := checkAlgorithm(alg); err != nil {
+		return nil, "", err
+	}
+
+	data = bytes.TrimSpace(data)
+	var key *PrivateKey
+	f := Detect(data)
+	err := fmt.Errorf("%w: %d bytes of data", ErrUnknownFormat, len(data))
+	switch f {
+	case PEM:
+		key, err = parsePEMPrivateKey(data)
+	case JWK:
+		key, err = parseJWKPrivateKey(data)
+	case Hex, Base64:
+		key, f, err = parseRaw(data, f, func(raw []byte) (*PrivateKey, error) {
+			return parseRawPrivateKey(raw, alg)
+		})
+	}
+	if err != nil {
+		return nil, f, err
+	}
+	if alg != "" && key.alg != alg {
+		key.Destroy()
+		return nil, f, fmt.Errorf("%w: %s key, expected %s", ErrInvalidKey, key.alg, alg)
+	}
+	return key, f, nil
+}
+
+// ParsePublicKey parses a public key in any supported format, and returns
+// it with the detected format. alg is required to parse raw compressed
+// ECDSA keys, whose point usually lies on both curves; if not empty, the
+// key must be of that algorithm.
+//
+// Hex data that is not a valid key is retried as Base64.
+func ParsePublicKey(data []byte, alg Algorithm) (*PublicKey, Format, error) {
+	if err := checkAlgorithm(alg); err != nil {
+		return nil, "", err
+	}
+
+	data = bytes.TrimSpace(data)
+	var key *PublicKey
+	f := Detect(data)
+	err := fmt.Errorf("%w: %d bytes of data", ErrUnknownFormat, len(data))
+	switch f {
+	case PEM:
+		key, err = parsePEMPublicKey(data)
+	case JWK:
+		key, err = parseJWKPublicKey(data)
+	case Hex, Base64:
+		key, f, err = parseRaw(data, f, func(raw []byte) (*PublicKey, error) {
+			return parseRawPublicKey(raw, alg)
+		})
+	}
+	if err != nil {
+		return nil, f, err
+	}
+	if alg != "" && key.alg != alg {
+		return nil, f, fmt.Errorf("%w: %s key, expected %s", ErrInvalidKey, key.alg, alg)
+	}
+	return key, f, nil
+}
+
+// ConvertPrivateKey parses a private key as ParsePrivateKey and returns it
+// encoded in format f.
+func ConvertPrivateKey(data []byte, alg Algorithm, f Format) ([]byte, error) {
+	key, _, err := ParsePrivateKey(data, alg)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Destroy()
+	return key.Encode(f)
+}
+
+// ConvertPublicKey parses a public key as ParsePublicKey and returns it
+// encoded in format f.
+func ConvertPublicKey(data []byte, alg Algorithm, f Format) ([]byte, error) {
+	key, _, err := ParsePublicKey(data, alg)
+	if err != nil {
+		return nil, err
+	}
+	return key.Encode(f)
+}
+
+// checkAlgorithm returns an error if alg is neither empty nor supported.
+func checkAlgorithm(alg Algorithm) error {
+	switch alg {
+	case "", Ed25519, P256, Secp256k1:
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+}
+
+// parseRaw decodes data in format f, Hex or Base64, and parses it with
+// parse. Hex data that parse rejects is retried as Base64.
+func parseRaw[K any](data []byte, f Format, parse func(raw []byte) (*K, error)) (*K, Format, error) {
+	if f == Hex {
+		raw := make([]byte, hex.DecodedLen(len(data)))
+		defer wipe(raw)
+		if _, err := hex.Decode(raw, data); err != nil {
+			return nil, f, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		key, err := parse(raw)
+		if err == nil {
+			return key, f, nil
+		}
+		raw, ok := decodeBase64(data)
+		if !ok {
+			return nil, f, err
+		}
+		defer wipe(raw)
+		if key, b64Err := parse(raw); b64Err == nil {
+			return key, Base64, nil
+		}
+		return nil, f, err
+	}
+
+	raw, ok := decodeBase64(data)
+	if !ok {
+		return nil, f, fmt.Errorf("%w: malformed base64", ErrInvalidKey)
+	}
+	defer wipe(raw)
+	key, err := parse(raw)
+	return key, f, err
+}
+
+// encodeRaw encodes raw in format f, Hex or Base64.
+func encodeRaw(f Format, raw []byte) []byte {
+	if f == Hex {
+		out := make([]byte, hex.EncodedLen(len(raw)))
+		hex.Encode(out, raw)
+		return out
+	}
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(raw)))
+	base64.StdEncoding.Encode(out, raw)
+	return out
+}
+
+// base64Encodings are the Base64 variants accepted when parsing.
+var base64Encodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.RawStdEncoding,
+	base64.URLEncoding,
+	base64.RawURLEncoding,
+}
+
+// decodeBase64 decodes data in any Base64 variant.
+func decodeBase64(data []byte) ([]byte, bool) {
+	for _, enc := range base64Encodings {
+		b := make([]byte, enc.DecodedLen(len(data)))
+		n, err := enc.Decode(b, data)
+		if err == nil {
+			return b[:n], true
+		}
+		wipe(b)
+	}
+	return nil, false
+}
+
+// isHex reports whether data is an even number of hex digits.
+func isHex(data []byte) bool {
+	if len(data)%2 != 0 {
+		return false
+	}
+	for _, c := range data {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// wipe zeroes b.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
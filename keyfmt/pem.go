@@ -0,0 +1,237 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyfmt
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+)
+
+// PEM block types.
+const (
+	pemPrivateKey   = "PRIVATE KEY"
+	pemECPrivateKey = "EC PRIVATE KEY"
+	pemPublicKey    = "PUBLIC KEY"
+)
+
+// crypto/x509 does not support secp256k1, whose PKCS#8, SEC1 and SPKI
+// structures are handled here.
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidCurveP256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+// pkcs8 is the PKCS#8 PrivateKeyInfo structure, see RFC 5208.
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	Attributes []asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// ecPrivateKeyInfo is the SEC1 ECPrivateKey structure, see RFC 5915.
+type ecPrivateKeyInfo struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// spki is the SubjectPublicKeyInfo structure, see RFC 5280.
+type spki struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// secp256k1Algorithm returns the algorithm identifier of secp256k1 keys.
+func secp256k1Algorithm() (pkix.AlgorithmIdentifier, error) {
+	params, err := asn1.Marshal(oidCurveSecp256k1)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  oidPublicKeyECDSA,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}, nil
+}
+
+// isSecp256k1 reports whether algo identifies secp256k1 keys.
+func isSecp256k1(algo pkix.AlgorithmIdentifier) bool {
+	if !algo.Algorithm.Equal(oidPublicKeyECDSA) {
+		return false
+	}
+	var curve asn1.ObjectIdentifier
+	_, err := asn1.Unmarshal(algo.Parameters.FullBytes, &curve)
+	return err == nil && curve.Equal(oidCurveSecp256k1)
+}
+
+// encodePEMPrivateKey returns the PKCS#8 PEM encoding of k.
+func encodePEMPrivateKey(k *PrivateKey) ([]byte, error) {
+	var der []byte
+	var err error
+	if k.alg == Secp256k1 {
+		der, err = marshalSecp256k1PKCS8(k.key.(*ecdsa.PrivateKey))
+	} else {
+		der, err = x509.MarshalPKCS8PrivateKey(k.key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	defer wipe(der)
+	return pem.EncodeToMemory(&pem.Block{Type: pemPrivateKey, Bytes: der}), nil
+}
+
+// marshalSecp256k1PKCS8 returns the PKCS#8 DER encoding of a secp256k1
+// key.
+func marshalSecp256k1PKCS8(key *ecdsa.PrivateKey) ([]byte, error) {
+	algo, err := secp256k1Algorithm()
+	if err != nil {
+		return nil, err
+	}
+	scalar := key.D.FillBytes(make([]byte, ecScalarSize))
+	defer wipe(scalar)
+	point := uncompressedPoint(&key.PublicKey)
+	inner, err := asn1.Marshal(ecPrivateKeyInfo{
+		Version:    1,
+		PrivateKey: scalar,
+		PublicKey:  asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(inner)
+	return asn1.Marshal(pkcs8{Algo: algo, PrivateKey: inner})
+}
+
+// encodePEMPublicKey returns the SPKI PEM encoding of k.
+func encodePEMPublicKey(k *PublicKey) ([]byte, error) {
+	var der []byte
+	var err error
+	if k.alg == Secp256k1 {
+		var algo pkix.AlgorithmIdentifier
+		if algo, err = secp256k1Algorithm(); err == nil {
+			point := uncompressedPoint(k.key.(*ecdsa.PublicKey))
+			der, err = asn1.Marshal(spki{
+				Algorithm: algo,
+				PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+			})
+		}
+	} else {
+		der, err = x509.MarshalPKIXPublicKey(k.key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemPublicKey, Bytes: der}), nil
+}
+
+// decodePEM returns the first PEM block of data, checking its type is one
+// of types.
+func decodePEM(data []byte, types ...string) (*pem.Block, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: malformed PEM", ErrInvalidKey)
+	}
+	for _, t := range types {
+		if block.Type == t {
+			return block, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unexpected PEM block %q", ErrInvalidKey, block.Type)
+}
+
+// parsePEMPrivateKey parses a PKCS#8 or SEC1 PEM private key.
+func parsePEMPrivateKey(data []byte) (*PrivateKey, error) {
+	block, err := decodePEM(data, pemPrivateKey, pemECPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(block.Bytes)
+
+	if block.Type == pemECPrivateKey {
+		return parseSEC1(block.Bytes, nil)
+	}
+
+	var info pkcs8
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err == nil && isSecp256k1(info.Algo) {
+		defer wipe(info.PrivateKey)
+		return parseSEC1(info.PrivateKey, oidCurveSecp256k1)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return NewPrivateKey(key)
+}
+
+// parseSEC1 parses a SEC1 ECPrivateKey. curve is the curve given by the
+// enclosing PKCS#8 structure, if any.
+func parseSEC1(der []byte, curve asn1.ObjectIdentifier) (*PrivateKey, error) {
+	var info ecPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	defer wipe(info.PrivateKey)
+	if curve == nil {
+		curve = info.NamedCurveOID
+	}
+
+	var alg Algorithm
+	switch {
+	case curve.Equal(oidCurveSecp256k1):
+		alg = Secp256k1
+	case curve.Equal(oidCurveP256):
+		alg = P256
+	default:
+		return nil, fmt.Errorf("%w: elliptic curve %v", ErrUnsupportedAlgorithm, curve)
+	}
+	key, err := ecPrivateKey(alg, info.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.PublicKey.Bytes) > 0 {
+		pub, err := ecPublicKey(alg, info.PublicKey.Bytes)
+		if err != nil || !pub.Equal(key.Public()) {
+			key.Destroy()
+			return nil, fmt.Errorf("%w: public key does not match private key", ErrInvalidKey)
+		}
+	}
+	return key, nil
+}
+
+// parsePEMPublicKey parses an SPKI PEM public key.
+func parsePEMPublicKey(data []byte) (*PublicKey, error) {
+	block, err := decodePEM(data, pemPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var info spki
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err == nil && isSecp256k1(info.Algorithm) {
+		return ecPublicKey(Secp256k1, info.PublicKey.Bytes)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return NewPublicKey(key)
+}
@@ -0,0 +1,189 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyfmt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"fmt"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// ecScalarSize is the size of P-256 and secp256k1 scalars and coordinates.
+const ecScalarSize = 32
+
+// curve returns the elliptic curve of an ECDSA algorithm.
+func curve(alg Algorithm) elliptic.Curve {
+	if alg == Secp256k1 {
+		return secp256k1.S256()
+	}
+	return elliptic.P256()
+}
+
+// curveAlgorithm returns the algorithm of keys on curve c.
+func curveAlgorithm(c elliptic.Curve) (Algorithm, error) {
+	if c != nil {
+		switch c.Params().Name {
+		case "P-256":
+			return P256, nil
+		case "secp256k1":
+			return Secp256k1, nil
+		}
+	}
+	return "", fmt.Errorf("%w: unsupported elliptic curve", ErrUnsupportedAlgorithm)
+}
+
+// ecPrivateKey returns the alg private key of scalar d.
+func ecPrivateKey(alg Algorithm, d []byte) (*PrivateKey, error) {
+	c := curve(alg)
+	k := new(big.Int).SetBytes(d)
+	if len(d) > ecScalarSize || k.Sign() == 0 || k.Cmp(c.Params().N) >= 0 {
+		k.SetInt64(0)
+		return nil, fmt.Errorf("%w: %s private scalar out of range", ErrInvalidKey, alg)
+	}
+	scalar := k.FillBytes(make([]byte, ecScalarSize))
+	defer wipe(scalar)
+	priv := &ecdsa.PrivateKey{D: k}
+	priv.Curve = c
+	priv.X, priv.Y = c.ScalarBaseMult(scalar)
+	return &PrivateKey{alg: alg, key: priv}, nil
+}
+
+// ecPublicKey returns the alg public key of point, compressed or not.
+func ecPublicKey(alg Algorithm, point []byte) (*PublicKey, error) {
+	if alg == Secp256k1 {
+		pub, err := secp256k1.ParsePubKey(point)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		return &PublicKey{alg: alg, key: pub.ToECDSA()}, nil
+	}
+
+	var x, y *big.Int
+	switch len(point) {
+	case 1 + ecScalarSize:
+		x, y = elliptic.UnmarshalCompressed(elliptic.P256(), point)
+	case 1 + 2*ecScalarSize:
+		x, y = elliptic.Unmarshal(elliptic.P256(), point)
+	}
+	if x == nil {
+		return nil, fmt.Errorf("%w: not a P-256 point", ErrInvalidKey)
+	}
+	return &PublicKey{alg: alg, key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+}
+
+// ecPoint returns the alg public key of coordinates x and y, checking the
+// point is on the curve.
+func ecPoint(alg Algorithm, x, y []byte) (*PublicKey, error) {
+	if len(x) != ecScalarSize || len(y) != ecScalarSize {
+		return nil, fmt.Errorf("%w: %s coordinates must be %d bytes", ErrInvalidKey, alg, ecScalarSize)
+	}
+	point := make([]byte, 0, 1+2*ecScalarSize)
+	point = append(point, 4)
+	point = append(point, x...)
+	point = append(point, y...)
+	return ecPublicKey(alg, point)
+}
+
+// rawPrivateKey returns the raw bytes of k, which the caller must wipe.
+func rawPrivateKey(k *PrivateKey) []byte {
+	switch key := k.key.(type) {
+	case ed25519.PrivateKey:
+		return append([]byte(nil), key...)
+	case *ecdsa.PrivateKey:
+		return key.D.FillBytes(make([]byte, ecScalarSize))
+	}
+	return nil
+}
+
+// rawPublicKey returns the raw bytes of k, compressed for ECDSA keys.
+func rawPublicKey(k *PublicKey) []byte {
+	switch key := k.key.(type) {
+	case ed25519.PublicKey:
+		return append([]byte(nil), key...)
+	case *ecdsa.PublicKey:
+		return elliptic.MarshalCompressed(key.Curve, key.X, key.Y)
+	}
+	return nil
+}
+
+// uncompressedPoint returns the uncompressed encoding of an ECDSA key.
+func uncompressedPoint(key *ecdsa.PublicKey) []byte {
+	point := make([]byte, 1+2*ecScalarSize)
+	point[0] = 4
+	key.X.FillBytes(point[1 : 1+ecScalarSize])
+	key.Y.FillBytes(point[1+ecScalarSize:])
+	return point
+}
+
+// parseRawPrivateKey parses the raw bytes of a private key. A 32 bytes key
+// needs alg.
+func parseRawPrivateKey(raw []byte, alg Algorithm) (*PrivateKey, error) {
+	switch {
+	case alg == "" && len(raw) == ed25519.PrivateKeySize:
+		alg = Ed25519
+	case alg == "" && len(raw) == ecScalarSize:
+		return nil, fmt.Errorf("%w: %d bytes private key", ErrAmbiguousAlgorithm, len(raw))
+	case alg == "":
+		return nil, fmt.Errorf("%w: %d bytes private key", ErrInvalidKey, len(raw))
+	}
+
+	if alg != Ed25519 {
+		return ecPrivateKey(alg, raw)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return &PrivateKey{alg: alg, key: ed25519.NewKeyFromSeed(raw)}, nil
+	case ed25519.PrivateKeySize:
+		key := ed25519.NewKeyFromSeed(raw[:ed25519.SeedSize])
+		if !key.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(raw[ed25519.SeedSize:])) {
+			wipe(key)
+			return nil, fmt.Errorf("%w: ed25519 public key does not match seed", ErrInvalidKey)
+		}
+		return &PrivateKey{alg: alg, key: key}, nil
+	}
+	return nil, fmt.Errorf("%w: %d bytes ed25519 private key", ErrInvalidKey, len(raw))
+}
+
+// parseRawPublicKey parses the raw bytes of a public key. Without alg, an
+// ECDSA point is tried on both curves, and must lie on exactly one.
+func parseRawPublicKey(raw []byte, alg Algorithm) (*PublicKey, error) {
+	switch {
+	case alg == Ed25519 || alg == "" && len(raw) == ed25519.PublicKeySize:
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: %d bytes ed25519 public key", ErrInvalidKey, len(raw))
+		}
+		return &PublicKey{alg: Ed25519, key: ed25519.PublicKey(append([]byte(nil), raw...))}, nil
+	case alg != "":
+		return ecPublicKey(alg, raw)
+	}
+
+	p256, err := ecPublicKey(P256, raw)
+	k1, k1Err := ecPublicKey(Secp256k1, raw)
+	switch {
+	case err == nil && k1Err == nil:
+		return nil, fmt.Errorf("%w: point is on both P-256 and secp256k1", ErrAmbiguousAlgorithm)
+	case err == nil:
+		return p256, nil
+	case k1Err == nil:
+		return k1, nil
+	}
+	return nil, fmt.Errorf("%w: %d bytes public key", ErrInvalidKey, len(raw))
+}
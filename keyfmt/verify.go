@@ -0,0 +1,75 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyfmt
+
+import (
+	"errors"
+)
+
+// ErrKeyMismatch means a public key is not the one of a private key.
+var ErrKeyMismatch = errors.New("public key does not match private key")
+
+// VerifyKeyPair checks that publicKey is the public key of privateKey,
+// both in any supported format. It returns ErrKeyMismatch if publicKey is
+// not the public key of privateKey, or does not parse, and the parsing
+// error if privateKey does not parse.
+//
+// The algorithm of a raw 32 bytes private key is not needed: the key pair
+// matches if publicKey is the public key of privateKey for any algorithm.
+func VerifyKeyPair(privateKey, publicKey []byte) error {
+	keys, err := privateKeyCandidates(privateKey)
+	if err != nil {
+		return err
+	}
+
+	match := false
+	for _, key := range keys {
+		public := key.Public()
+		key.Destroy()
+		if !match {
+			pub, _, err := ParsePublicKey(publicKey, public.alg)
+			match = err == nil && pub.Equal(public)
+		}
+	}
+	if !match {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+// privateKeyCandidates parses data, for every algorithm if its raw encoding
+// does not tell the algorithm.
+func privateKeyCandidates(data []byte) ([]*PrivateKey, error) {
+	key, _, err := ParsePrivateKey(data, "")
+	if err == nil {
+		return []*PrivateKey{key}, nil
+	}
+	if !errors.Is(err, ErrAmbiguousAlgorithm) {
+		return nil, err
+	}
+
+	var keys []*PrivateKey
+	for _, alg := range []Algorithm{Ed25519, P256, Secp256k1} {
+		if key, _, algErr := ParsePrivateKey(data, alg); algErr == nil {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, err
+	}
+	return keys, nil
+}
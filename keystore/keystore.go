@@ -0,0 +1,381 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package keystore encrypts safebox key pairs into password-protected
+// keystore files, for offline backups and moves between environments.
+//
+// A keystore is a versioned JSON document holding the user DID, the public
+// key and metadata in clear, and the private key encrypted with AES-256-GCM
+// under a key derived from the password with scrypt or Argon2id. The clear
+// fields are authenticated: altering any of them makes decryption fail.
+//
+//	ks, err := keystore.Encrypt(userDid, privateKey, publicKey, password, nil)
+//	...
+//	err = keystore.WriteFile("alice.json", ks)
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Version is the keystore format version written by Encrypt.
+const Version = 1
+
+// KDF is a password-based key derivation function.
+type KDF string
+
+// Supported key derivation functions.
+const (
+	Scrypt   KDF = "scrypt"
+	Argon2id KDF = "argon2id"
+)
+
+// cipherAES256GCM is the only supported cipher.
+const cipherAES256GCM = "aes-256-gcm"
+
+const (
+	keySize  = 32
+	saltSize = 16
+)
+
+// Default and maximum KDF parameters. The maxima bound the resources spent
+// decrypting a keystore from an untrusted source.
+const (
+	DefaultScryptN       = 1 << 15
+	DefaultScryptR       = 8
+	DefaultScryptP       = 1
+	DefaultArgon2Time    = 3
+	DefaultArgon2Memory  = 64 * 1024
+	DefaultArgon2Threads = 4
+
+	maxScryptN      = 1 << 20
+	maxScryptR      = 32
+	maxScryptP      = 16
+	maxArgon2Time   = 16
+	maxArgon2Memory = 1024 * 1024
+)
+
+// Errors returned by Decrypt and Read.
+var (
+	// ErrWrongPassword means the password is wrong, or the keystore was
+	// altered.
+	ErrWrongPassword = errors.New("wrong password or altered keystore")
+	// ErrUnsupportedVersion means the keystore was written by a newer
+	// version of the format.
+	ErrUnsupportedVersion = errors.New("unsupported keystore version")
+	// ErrInvalidKeystore means the keystore is malformed, or its parameters
+	// are unsupported or out of bounds.
+	ErrInvalidKeystore = errors.New("invalid keystore")
+)
+
+// Options configures Encrypt. The zero value selects scrypt with the
+// default parameters.
+type Options struct {
+	KDF KDF
+	// ScryptN, ScryptR and ScryptP are the scrypt cost parameters.
+	ScryptN, ScryptR, ScryptP int
+	// Argon2Time is the number of Argon2id passes, Argon2Memory its memory
+	// in KiB and Argon2Threads its parallelism.
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+	// Metadata is stored in clear in the keystore, e.g. the environment the
+	// key pair was exported from.
+	Metadata map[string]string
+}
+
+// Keystore is an encrypted key pair.
+type Keystore struct {
+	Version   int               `json:"version"`
+	UserDid   string            `json:"user_did"`
+	PublicKey string            `json:"public_key"`
+	CreatedAt time.Time         `json:"created_at"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	KDF       KDFParams         `json:"kdf"`
+	Cipher    CipherParams      `json:"cipher"`
+	// Ciphertext is the encrypted private key.
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// KDFParams are the parameters of the key derivation.
+type KDFParams struct {
+	Name    KDF    `json:"name"`
+	Salt    []byte `json:"salt"`
+	N       int    `json:"n,omitempty"`
+	R       int    `json:"r,omitempty"`
+	P       int    `json:"p,omitempty"`
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+}
+
+// CipherParams are the parameters of the private key encryption.
+type CipherParams struct {
+	Name  string `json:"name"`
+	Nonce []byte `json:"nonce"`
+}
+
+// Encrypt returns the keystore of the key pair of userDid, with the private
+// key encrypted under password. opts may be nil.
+func Encrypt(userDid, privateKey, publicKey string, password []byte, opts *Options) (*Keystore, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if userDid == "" || privateKey == "" {
+		return nil, fmt.Errorf("user DID and private key are required")
+	}
+	if len(password) == 0 {
+		return nil, fmt.Errorf("password is empty")
+	}
+
+	ks := &Keystore{
+		Version:   Version,
+		UserDid:   userDid,
+		PublicKey: publicKey,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Metadata:  copyMetadata(opts.Metadata),
+		KDF:       kdfParams(opts),
+		Cipher:    CipherParams{Name: cipherAES256GCM},
+	}
+	if err := ks.KDF.check(); err != nil {
+		return nil, err
+	}
+	ks.KDF.Salt = make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, ks.KDF.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := ks.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	ks.Cipher.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, ks.Cipher.Nonce); err != nil {
+		return nil, err
+	}
+	ad, err := ks.additionalData()
+	if err != nil {
+		return nil, err
+	}
+	plaintext := []byte(privateKey)
+	defer wipe(plaintext)
+	ks.Ciphertext = aead.Seal(nil, ks.Cipher.Nonce, plaintext, ad)
+	return ks, nil
+}
+
+// Decrypt returns the private key of ks, which the caller should wipe once
+// used.
+func (ks *Keystore) Decrypt(password []byte) ([]byte, error) {
+	if err := ks.check(); err != nil {
+		return nil, err
+	}
+	aead, err := ks.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	if len(ks.Cipher.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: nonce is %d bytes", ErrInvalidKeystore, len(ks.Cipher.Nonce))
+	}
+	ad, err := ks.additionalData()
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := aead.Open(nil, ks.Cipher.Nonce, ks.Ciphertext, ad)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	return privateKey, nil
+}
+
+// Write writes ks to w as indented JSON.
+func Write(w io.Writer, ks *Keystore) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ks)
+}
+
+// Read reads a keystore written by Write, checking its version and
+// parameters.
+func Read(r io.Reader) (*Keystore, error) {
+	var ks Keystore
+	if err := json.NewDecoder(r).Decode(&ks); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeystore, err)
+	}
+	if err := ks.check(); err != nil {
+		return nil, err
+	}
+	return &ks, nil
+}
+
+// WriteFile writes ks to the file at path, created readable by its owner
+// only. An existing file is not overwritten.
+func WriteFile(path string, ks *Keystore) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, ks); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadFile reads the keystore file at path.
+func ReadFile(path string) (*Keystore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// copyMetadata returns a copy of m, nil if empty.
+func copyMetadata(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// kdfParams returns the KDF parameters selected by opts, defaults filled
+// in.
+func kdfParams(opts *Options) KDFParams {
+	if opts.KDF == Argon2id {
+		p := KDFParams{Name: Argon2id, Time: opts.Argon2Time, Memory: opts.Argon2Memory, Threads: opts.Argon2Threads}
+		if p.Time == 0 {
+			p.Time = DefaultArgon2Time
+		}
+		if p.Memory == 0 {
+			p.Memory = DefaultArgon2Memory
+		}
+		if p.Threads == 0 {
+			p.Threads = DefaultArgon2Threads
+		}
+		return p
+	}
+
+	p := KDFParams{Name: opts.KDF, N: opts.ScryptN, R: opts.ScryptR, P: opts.ScryptP}
+	if p.Name == "" {
+		p.Name = Scrypt
+	}
+	if p.N == 0 {
+		p.N = DefaultScryptN
+	}
+	if p.R == 0 {
+		p.R = DefaultScryptR
+	}
+	if p.P == 0 {
+		p.P = DefaultScryptP
+	}
+	return p
+}
+
+// check returns an error if ks cannot be decrypted by this version.
+func (ks *Keystore) check() error {
+	if ks.Version > Version {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, ks.Version)
+	}
+	if ks.Version < 1 || ks.UserDid == "" || len(ks.Ciphertext) == 0 {
+		return fmt.Errorf("%w: missing fields", ErrInvalidKeystore)
+	}
+	if ks.Cipher.Name != cipherAES256GCM {
+		return fmt.Errorf("%w: cipher %q", ErrInvalidKeystore, ks.Cipher.Name)
+	}
+	if len(ks.KDF.Salt) == 0 {
+		return fmt.Errorf("%w: salt is empty", ErrInvalidKeystore)
+	}
+	return ks.KDF.check()
+}
+
+// check returns an error if p names an unsupported KDF or is out of
+// bounds.
+func (p *KDFParams) check() error {
+	switch p.Name {
+	case Scrypt:
+		if p.N < 2 || p.N&(p.N-1) != 0 || p.N > maxScryptN || p.R < 1 || p.R > maxScryptR || p.P < 1 || p.P > maxScryptP {
+			return fmt.Errorf("%w: scrypt parameters N=%d r=%d p=%d", ErrInvalidKeystore, p.N, p.R, p.P)
+		}
+	case Argon2id:
+		if p.Time < 1 || p.Time > maxArgon2Time || p.Memory < 8*uint32(p.Threads) || p.Memory > maxArgon2Memory || p.Threads < 1 {
+			return fmt.Errorf("%w: argon2id parameters time=%d memory=%d threads=%d", ErrInvalidKeystore, p.Time, p.Memory, p.Threads)
+		}
+	default:
+		return fmt.Errorf("%w: KDF %q", ErrInvalidKeystore, p.Name)
+	}
+	return nil
+}
+
+// aead returns the cipher keyed by the key derived from password.
+func (ks *Keystore) aead(password []byte) (cipher.AEAD, error) {
+	var key []byte
+	switch ks.KDF.Name {
+	case Scrypt:
+		var err error
+		if key, err = scrypt.Key(password, ks.KDF.Salt, ks.KDF.N, ks.KDF.R, ks.KDF.P, keySize); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKeystore, err)
+		}
+	case Argon2id:
+		key = argon2.IDKey(password, ks.KDF.Salt, ks.KDF.Time, ks.KDF.Memory, ks.KDF.Threads, keySize)
+	}
+	defer wipe(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData returns the fields of ks authenticated along with the
+// private key: all of them but the ciphertext.
+func (ks *Keystore) additionalData() ([]byte, error) {
+	header := *ks
+	header.Ciphertext = nil
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(&header); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// wipe zeroes b.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Cheap parameters, to keep tests fast.
+var (
+	testScrypt = &Options{ScryptN: 1024, Metadata: map[string]string{"env": "test"}}
+	testArgon2 = &Options{KDF: Argon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 1}
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	for _, opts := range []*Options{testScrypt, testArgon2} {
+		ks, err := Encrypt("did:1", "privatekey", "publickey", []byte("password"), opts)
+		if err != nil {
+			t.Fatalf("Encrypt error, %v", err)
+		}
+		if bytes.Contains(ks.Ciphertext, []byte("privatekey")) {
+			t.Fatalf("private key stored in clear")
+		}
+
+		// Round trip through the JSON encoding
+		var b bytes.Buffer
+		if err := Write(&b, ks); err != nil {
+			t.Fatalf("Write error, %v", err)
+		}
+		read, err := Read(&b)
+		if err != nil {
+			t.Fatalf("Read error, %v", err)
+		}
+		if read.UserDid != "did:1" || read.PublicKey != "publickey" || read.KDF.Name != ks.KDF.Name {
+			t.Fatalf("unexpected keystore %+v", read)
+		}
+
+		privateKey, err := read.Decrypt([]byte("password"))
+		if err != nil {
+			t.Fatalf("Decrypt error, %v", err)
+		}
+		if string(privateKey) != "privatekey" {
+			t.Fatalf("decrypted %q", privateKey)
+		}
+		if _, err := read.Decrypt([]byte("wrong")); !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("expected ErrWrongPassword, got %v", err)
+		}
+	}
+}
+
+func TestAuthenticatedFields(t *testing.T) {
+	for name, alter := range map[string]func(ks *Keystore){
+		"did":        func(ks *Keystore) { ks.UserDid = "did:2" },
+		"public key": func(ks *Keystore) { ks.PublicKey = "other" },
+		"metadata":   func(ks *Keystore) { ks.Metadata["env"] = "prod" },
+		"ciphertext": func(ks *Keystore) { ks.Ciphertext[0] ^= 1 },
+	} {
+		ks, err := Encrypt("did:1", "privatekey", "publickey", []byte("password"), testScrypt)
+		if err != nil {
+			t.Fatalf("Encrypt error, %v", err)
+		}
+		ks.Metadata = map[string]string{"env": "test"}
+		alter(ks)
+		if _, err := ks.Decrypt([]byte("password")); !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("%s: expected ErrWrongPassword, got %v", name, err)
+		}
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	ks, err := Encrypt("did:1", "privatekey", "publickey", []byte("password"), testScrypt)
+	if err != nil {
+		t.Fatalf("Encrypt error, %v", err)
+	}
+	var b bytes.Buffer
+	Write(&b, ks)
+	valid := b.String()
+
+	for name, tc := range map[string]struct {
+		old, new string
+		err      error
+	}{
+		"version": {`"version": 1`, `"version": 2`, ErrUnsupportedVersion},
+		"kdf":     {`"name": "scrypt"`, `"name": "pbkdf2"`, ErrInvalidKeystore},
+		"cost":    {`"n": 1024`, `"n": 1073741824`, ErrInvalidKeystore},
+		"cipher":  {`"name": "aes-256-gcm"`, `"name": "none"`, ErrInvalidKeystore},
+		"json":    {`{`, `[`, ErrInvalidKeystore},
+	} {
+		data := strings.Replace(valid, tc.old, tc.new, 1)
+		if data == valid {
+			t.Fatalf("%s: %q not found", name, tc.old)
+		}
+		if _, err := Read(strings.NewReader(data)); !errors.Is(err, tc.err) {
+			t.Fatalf("%s: expected %v, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	ks, err := Encrypt("did:1", "privatekey", "publickey", []byte("password"), testArgon2)
+	if err != nil {
+		t.Fatalf("Encrypt error, %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "did1.json")
+	if err := WriteFile(path, ks); err != nil {
+		t.Fatalf("WriteFile error, %v", err)
+	}
+	if err := WriteFile(path, ks); err == nil {
+		t.Fatalf("WriteFile overwrote an existing file")
+	}
+
+	read, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile error, %v", err)
+	}
+	if privateKey, err := read.Decrypt([]byte("password")); err != nil || string(privateKey) != "privatekey" {
+		t.Fatalf("Decrypt = %q, %v", privateKey, err)
+	}
+}
@@ -7,9 +7,8 @@
 
 set -e
 
-export GO15VENDOREXPERIMENT=1
 echo -n "Obtaining list of tests to run.."
-PKGS=`go list github.com/arxanchain/safebox-sdk-go/... | grep -v /vendor/`
+PKGS=`go list github.com/arxanchain/safebox-sdk-go/...`
 echo "DONE!"
 
 echo "Running tests..."
@@ -10,7 +10,7 @@ set -e
 echo "LINT: Running code checks.."
 echo "Running go vet"
 
-cd $GOPATH/src/github.com/arxanchain/safebox-sdk-go/
+cd "$(dirname "$0")/.."
 
 for i in `ls -d */|grep -v gotools |grep -v scripts`
 do
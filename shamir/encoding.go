@@ -0,0 +1,109 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shamir
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+// Text encoding of shares: the prefix followed by the base32 encoding of
+//
+//	version (1) | id (4) | threshold (1) | index (1) | value | crc32 (4)
+//
+// split in groups of groupSize characters by dashes. Parsing ignores case,
+// dashes and white space, so shares can be written down and typed back.
+const (
+	sharePrefix  = "SBXS"
+	shareVersion = 1
+	groupSize    = 5
+	headerSize   = 1 + 4 + 1 + 1
+	crcSize      = 4
+)
+
+var shareEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// String returns the text encoding of s.
+func (s *Share) String() string {
+	b := make([]byte, 0, headerSize+len(s.Value)+crcSize)
+	b = append(b, shareVersion)
+	b = append(b, s.ID[:]...)
+	b = append(b, byte(s.Threshold), s.Index)
+	b = append(b, s.Value...)
+	var sum [crcSize]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(b))
+	b = append(b, sum[:]...)
+	text := shareEncoding.EncodeToString(b)
+	wipe(b)
+
+	var out strings.Builder
+	out.WriteString(sharePrefix)
+	for i := 0; i < len(text); i += groupSize {
+		end := i + groupSize
+		if end > len(text) {
+			end = len(text)
+		}
+		out.WriteByte('-')
+		out.WriteString(text[i:end])
+	}
+	return out.String()
+}
+
+// ParseShare parses the text encoding of a share, as returned by
+// Share.String.
+func ParseShare(text string) (*Share, error) {
+	text = strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(text))
+	if !strings.HasPrefix(text, sharePrefix) {
+		return nil, fmt.Errorf("%w: missing %s prefix", ErrInvalidShare, sharePrefix)
+	}
+
+	b, err := shareEncoding.DecodeString(text[len(sharePrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShare, err)
+	}
+	defer wipe(b)
+	if len(b) <= headerSize+secretChecksumSize+crcSize {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidShare)
+	}
+	body, sum := b[:len(b)-crcSize], b[len(b)-crcSize:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidShare)
+	}
+	if body[0] != shareVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidShare, body[0])
+	}
+
+	s := &Share{
+		Threshold: int(body[5]),
+		Index:     body[6],
+		Value:     append([]byte(nil), body[headerSize:]...),
+	}
+	copy(s.ID[:], body[1:5])
+	if s.Threshold < 2 || s.Index == 0 {
+		return nil, fmt.Errorf("%w: bad threshold or index", ErrInvalidShare)
+	}
+	return s, nil
+}
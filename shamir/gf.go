@@ -0,0 +1,61 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shamir
+
+// Arithmetic in GF(2^8) with the AES reduction polynomial
+// x^8 + x^4 + x^3 + x + 1. Addition is xor. Multiplication runs in constant
+// time, so that it does not leak the secret bytes through timing.
+
+// mul returns a * b.
+func mul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		// p ^= a if the low bit of b is set
+		p ^= a & -(b & 1)
+		// a *= x, reduced if its high bit was set
+		a = a<<1 ^ 0x1b&-(a>>7)
+		b >>= 1
+	}
+	return p
+}
+
+// inv returns the multiplicative inverse of a, a^254, or 0 if a is 0.
+func inv(a byte) byte {
+	// a^254 = a^(2+4+8+16+32+64+128)
+	result := byte(1)
+	sq := a
+	for i := 0; i < 7; i++ {
+		sq = mul(sq, sq)
+		result = mul(result, sq)
+	}
+	return result
+}
+
+// div returns a / b. b must not be 0.
+func div(a, b byte) byte {
+	return mul(a, inv(b))
+}
+
+// evaluate returns the value at x of the polynomial of coefficients coeffs,
+// constant term first.
+func evaluate(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coeffs[i]
+	}
+	return y
+}
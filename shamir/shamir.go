@@ -0,0 +1,228 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package shamir splits secrets, such as safebox security codes or private
+// keys, into M-of-N Shamir shares and combines them back.
+//
+// Any threshold shares of a split rebuild the secret, fewer reveal nothing
+// about it. Each share carries a checksum detecting typos in its text
+// encoding, and the secret carries a checksum detecting a rebuild from
+// wrong shares:
+//
+//	shares, err := shamir.SplitString(reply.Code, 3, 5)
+//	...
+//	code, err := shamir.CombineString(shares[1:4])
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+)
+
+// MaxShares is the maximum number of shares of a split.
+const MaxShares = 255
+
+// secretChecksumSize is the size of the checksum appended to the secret
+// before it is split.
+const secretChecksumSize = 4
+
+// Errors returned by Split and Combine.
+var (
+	// ErrInvalidParameters means the threshold or number of shares is out
+	// of range, or the secret is empty.
+	ErrInvalidParameters = fmt.Errorf("invalid split parameters")
+	// ErrInvalidShare means a share is malformed or its checksum does not
+	// match.
+	ErrInvalidShare = fmt.Errorf("invalid share")
+	// ErrNotEnoughShares means fewer shares than the threshold were given.
+	ErrNotEnoughShares = fmt.Errorf("not enough shares")
+	// ErrMismatchedShares means the shares do not come from the same split.
+	ErrMismatchedShares = fmt.Errorf("shares come from different splits")
+	// ErrChecksum means the rebuilt secret does not match its checksum: at
+	// least one share is wrong.
+	ErrChecksum = fmt.Errorf("secret checksum mismatch")
+)
+
+// Share is a share of a split secret.
+type Share struct {
+	// ID identifies the split the share belongs to.
+	ID [4]byte
+	// Threshold is the number of shares needed to rebuild the secret.
+	Threshold int
+	// Index is the x coordinate of the share, from 1 to MaxShares.
+	Index byte
+	// Value holds the y coordinates of the share, one per byte of the
+	// secret and its checksum.
+	Value []byte
+}
+
+// Split splits secret into n shares, any threshold of which rebuild it.
+// threshold must be at least 2 and at most n, n at most MaxShares.
+func Split(secret []byte, threshold, n int) ([]Share, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%w: secret is empty", ErrInvalidParameters)
+	}
+	if threshold < 2 || threshold > n || n > MaxShares {
+		return nil, fmt.Errorf("%w: threshold %d of %d shares", ErrInvalidParameters, threshold, n)
+	}
+
+	var id [4]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	data := appendChecksum(secret)
+	defer wipe(data)
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{
+			ID:        id,
+			Threshold: threshold,
+			Index:     byte(i + 1),
+			Value:     make([]byte, len(data)),
+		}
+	}
+
+	// One random polynomial of degree threshold-1 per byte, whose constant
+	// term is the byte
+	coeffs := make([]byte, threshold)
+	defer wipe(coeffs)
+	for j, b := range data {
+		coeffs[0] = b
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			shares[i].Value[j] = evaluate(coeffs, shares[i].Index)
+		}
+	}
+	return shares, nil
+}
+
+// Combine rebuilds the secret from shares. At least the threshold of the
+// split must be given; extra shares are ignored.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrNotEnoughShares
+	}
+	first := shares[0]
+	if first.Threshold < 2 || len(first.Value) <= secretChecksumSize {
+		return nil, ErrInvalidShare
+	}
+
+	seen := make(map[byte]bool, len(shares))
+	for _, s := range shares {
+		if s.ID != first.ID || s.Threshold != first.Threshold || len(s.Value) != len(first.Value) {
+			return nil, ErrMismatchedShares
+		}
+		if s.Index == 0 {
+			return nil, ErrInvalidShare
+		}
+		if seen[s.Index] {
+			return nil, fmt.Errorf("%w: share %d is duplicated", ErrInvalidShare, s.Index)
+		}
+		seen[s.Index] = true
+	}
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("%w: %d of %d", ErrNotEnoughShares, len(shares), first.Threshold)
+	}
+	shares = shares[:first.Threshold]
+
+	// Lagrange interpolation at x = 0
+	data := make([]byte, len(first.Value))
+	for i, si := range shares {
+		basis := byte(1)
+		for k, sk := range shares {
+			if k != i {
+				// sk.Index / (sk.Index - si.Index), subtraction is xor
+				basis = mul(basis, div(sk.Index, sk.Index^si.Index))
+			}
+		}
+		for j := range data {
+			data[j] ^= mul(basis, si.Value[j])
+		}
+	}
+
+	secret, ok := verifyChecksum(data)
+	if !ok {
+		wipe(data)
+		return nil, ErrChecksum
+	}
+	return secret, nil
+}
+
+// SplitString splits secret into n shares, any threshold of which rebuild
+// it, and returns their text encoding.
+func SplitString(secret string, threshold, n int) ([]string, error) {
+	b := []byte(secret)
+	defer wipe(b)
+	shares, err := Split(b, threshold, n)
+	if err != nil {
+		return nil, err
+	}
+	texts := make([]string, len(shares))
+	for i, s := range shares {
+		texts[i] = s.String()
+		wipe(s.Value)
+	}
+	return texts, nil
+}
+
+// CombineString rebuilds the secret from the text encoding of shares.
+func CombineString(texts []string) (string, error) {
+	shares := make([]Share, len(texts))
+	for i, text := range texts {
+		s, err := ParseShare(text)
+		if err != nil {
+			return "", err
+		}
+		shares[i] = *s
+	}
+	secret, err := Combine(shares)
+	for _, s := range shares {
+		wipe(s.Value)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer wipe(secret)
+	return string(secret), nil
+}
+
+// appendChecksum returns a copy of secret followed by its checksum.
+func appendChecksum(secret []byte) []byte {
+	sum := sha256.Sum256(secret)
+	data := make([]byte, 0, len(secret)+secretChecksumSize)
+	data = append(data, secret...)
+	return append(data, sum[:secretChecksumSize]...)
+}
+
+// verifyChecksum returns the secret of data and whether its checksum
+// matches.
+func verifyChecksum(data []byte) ([]byte, bool) {
+	secret := data[:len(data)-secretChecksumSize]
+	sum := sha256.Sum256(secret)
+	return secret, bytes.Equal(sum[:secretChecksumSize], data[len(secret):])
+}
+
+// wipe zeroes b.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
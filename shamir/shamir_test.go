@@ -0,0 +1,126 @@
+/*
+Copyright ArxanFintech Technology Ltd. 2018 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shamir
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGFInverse(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if p := mul(byte(a), inv(byte(a))); p != 1 {
+			t.Fatalf("%d * inv(%d) should be 1, got %d", a, a, p)
+		}
+	}
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("我是中国人")
+	shares, err := Split(secret, 3, 5)
+	if err != nil {
+		t.Fatalf("split error, %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("expected 5 shares, got %d", len(shares))
+	}
+
+	// Every subset of 3 shares rebuilds the secret
+	for i := 0; i < 5; i++ {
+		for j := i + 1; j < 5; j++ {
+			for k := j + 1; k < 5; k++ {
+				got, err := Combine([]Share{shares[k], shares[i], shares[j]})
+				if err != nil {
+					t.Fatalf("combine %d %d %d error, %v", i, j, k, err)
+				}
+				if !bytes.Equal(got, secret) {
+					t.Fatalf("combine %d %d %d should rebuild the secret, got %q", i, j, k, got)
+				}
+			}
+		}
+	}
+
+	if _, err = Combine(shares[:2]); !errors.Is(err, ErrNotEnoughShares) {
+		t.Fatalf("expected ErrNotEnoughShares, got %v", err)
+	}
+	if _, err = Combine([]Share{shares[0], shares[0], shares[1]}); !errors.Is(err, ErrInvalidShare) {
+		t.Fatalf("expected ErrInvalidShare for duplicated share, got %v", err)
+	}
+}
+
+func TestSplitInvalidParameters(t *testing.T) {
+	for _, c := range []struct{ threshold, n int }{{1, 3}, {4, 3}, {2, 256}} {
+		if _, err := Split([]byte("secret"), c.threshold, c.n); !errors.Is(err, ErrInvalidParameters) {
+			t.Fatalf("%d of %d should fail with ErrInvalidParameters, got %v", c.threshold, c.n, err)
+		}
+	}
+	if _, err := Split(nil, 2, 3); !errors.Is(err, ErrInvalidParameters) {
+		t.Fatalf("empty secret should fail with ErrInvalidParameters, got %v", err)
+	}
+}
+
+func TestCombineChecksum(t *testing.T) {
+	shares, err := Split([]byte("secret"), 2, 3)
+	if err != nil {
+		t.Fatalf("split error, %v", err)
+	}
+	shares[1].Value[0] ^= 1
+	if _, err = Combine(shares[:2]); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("expected ErrChecksum, got %v", err)
+	}
+
+	other, err := Split([]byte("secret"), 2, 3)
+	if err != nil {
+		t.Fatalf("split error, %v", err)
+	}
+	if _, err = Combine([]Share{shares[0], other[1]}); !errors.Is(err, ErrMismatchedShares) {
+		t.Fatalf("expected ErrMismatchedShares, got %v", err)
+	}
+}
+
+func TestShareText(t *testing.T) {
+	texts, err := SplitString("8f14e45fceea167a", 2, 3)
+	if err != nil {
+		t.Fatalf("split error, %v", err)
+	}
+	if !strings.HasPrefix(texts[0], "SBXS-") {
+		t.Fatalf("unexpected share encoding %s", texts[0])
+	}
+
+	// Case, dashes and spaces do not matter
+	typed := strings.ToLower(strings.Replace(texts[2], "-", " ", -1))
+	code, err := CombineString([]string{typed, texts[0]})
+	if err != nil {
+		t.Fatalf("combine error, %v", err)
+	}
+	if code != "8f14e45fceea167a" {
+		t.Fatalf("combine should rebuild the code, got %s", code)
+	}
+
+	// A typo is caught by the share checksum
+	b := []byte(texts[1])
+	if b[6] == 'A' {
+		b[6] = 'B'
+	} else {
+		b[6] = 'A'
+	}
+	if _, err = ParseShare(string(b)); !errors.Is(err, ErrInvalidShare) {
+		t.Fatalf("expected ErrInvalidShare, got %v", err)
+	}
+}